@@ -2,16 +2,27 @@ package colfmt // import "github.com/mndrix/colfmt"
 import (
 	"bufio"
 	"bytes"
+	"encoding/csv"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"net"
 	"os"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"golang.org/x/crypto/ssh/terminal"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
 )
 
 type Alignment int
@@ -19,6 +30,7 @@ type Alignment int
 const (
 	AlignLeft Alignment = iota
 	AlignRight
+	AlignCenter
 )
 
 type ColumnType int
@@ -26,8 +38,73 @@ type ColumnType int
 const (
 	TypeString ColumnType = iota
 	TypeAge
+	TypeEnum
+	TypeDuration
+	TypeOrdinal
+	TypeGroup
+	TypeIP
+	TypeBar
+	TypeNumber
+	TypeDate
+	TypeBool
+	TypePercent
 )
 
+// String returns the spec keyword which chooses this type.
+func (t ColumnType) String() string {
+	switch t {
+	case TypeString:
+		return "string"
+	case TypeAge:
+		return "age"
+	case TypeEnum:
+		return "enum"
+	case TypeDuration:
+		return "duration"
+	case TypeOrdinal:
+		return "ordinal"
+	case TypeGroup:
+		return "group"
+	case TypeIP:
+		return "ip"
+	case TypeBar:
+		return "bar"
+	case TypeNumber:
+		return "num"
+	case TypeDate:
+		return "date"
+	case TypeBool:
+		return "bool"
+	case TypePercent:
+		return "percent"
+	}
+	return fmt.Sprintf("ColumnType(%d)", int(t))
+}
+
+// Truncation chooses which part of a cell is cut when it's too wide
+// for its column.
+type Truncation int
+
+const (
+	// TruncateAuto cuts the end farthest from the column's aligned
+	// edge, so right-aligned columns lose their head.
+	TruncateAuto Truncation = iota
+
+	// TruncateLeft cuts the head of the cell, keeping its tail.
+	TruncateLeft
+
+	// TruncateMiddle cuts the middle of the cell, keeping both ends.
+	TruncateMiddle
+
+	// TruncatePath cuts whole directories from the middle of a file
+	// path, keeping its first directory and its base name.  Cells
+	// which can't be cut that way are truncated like TruncateAuto.
+	TruncatePath
+)
+
+// ColumnSpec describes how to format one column.  Its zero value
+// isn't a plain column: WidthMax 0 hides the column and Decimals 0
+// rounds numbers to integers.  Start from NewColumnSpec instead.
 type ColumnSpec struct {
 	// Align indicates how text inside this column should be aligned
 	Align Alignment
@@ -39,8 +116,143 @@ type ColumnSpec struct {
 	WidthMin int
 
 	// WidthMax is the maximum allowed width for this column.  -1
-	// means there is no maximum.
+	// means there is no maximum; 0 means the column is hidden.
 	WidthMax int
+
+	// Weight controls how much this column changes, relative to
+	// other flexible columns, when widths are adjusted to fit the
+	// terminal.  A column with weight 2 shrinks as though it were
+	// twice as wide, and grows as though it were half as wide.  0
+	// means 1.
+	Weight int
+
+	// WidthPercent, if positive, fixes the column's width at this
+	// percentage of the terminal's width, overriding WidthMin and
+	// WidthMax.  It's ignored when the terminal's width is unknown.
+	WidthPercent int
+
+	// Enum maps input values to short symbols for TypeEnum columns.
+	Enum map[string]string
+
+	// EnumColors maps enum symbols to ANSI SGR escape sequences.
+	// Symbols without a color use Color.
+	EnumColors map[string]string
+
+	// Group holds the sizes of character groups for TypeGroup
+	// columns.  a single size repeats across the whole value.
+	Group []int
+
+	// GroupSeparator is placed between groups in TypeGroup columns.
+	GroupSeparator string
+
+	// ZeroPad pads the octets of TypeIP columns with zeros instead of
+	// spaces.
+	ZeroPad bool
+
+	// BarTarget is the value which fills an entire TypeBar column.
+	// Larger values are highlighted.  0 means the column's largest
+	// value.
+	BarTarget float64
+
+	// Scale multiplies numeric values before they're rendered.  0
+	// means values aren't scaled.
+	Scale float64
+
+	// Decimals is the number of decimal places shown for numeric
+	// values.  -1 means as many as necessary.
+	Decimals int
+
+	// DateLayout is the Go reference time layout used by TypeDate
+	// columns.  An empty layout means dateLayout.
+	DateLayout string
+
+	// Clock renders TypeDuration columns as a zero-padded clock like
+	// 01:02:03.
+	Clock bool
+
+	// Heat colors numeric values according to the highest band whose
+	// threshold they reach.  Bands are sorted by threshold.
+	Heat []HeatBand
+
+	// Delta replaces each numeric value with its difference from the
+	// previous row's value.
+	Delta bool
+
+	// PercentPoints means TypePercent values are already out of 100,
+	// rather than ratios like 0.25.
+	PercentPoints bool
+
+	// AlignDecimal lines up the decimal points of the column's
+	// values, implying AlignRight for their integer parts.
+	AlignDecimal bool
+
+	// Hidden omits the column from the output.
+	Hidden bool
+
+	// Wrap breaks cells which are too wide onto additional lines,
+	// instead of truncating them.
+	Wrap bool
+
+	// Truncation chooses which part of a cell is cut when it's too
+	// wide.
+	Truncation Truncation
+
+	// Trim removes whitespace surrounding each cell before it's
+	// rendered or measured.
+	Trim bool
+
+	// Total chooses how the summary row aggregates this column: sum,
+	// avg, min, max or count.  "" sums TypeNumber columns and leaves
+	// others blank.
+	Total string
+
+	// Empty, if not "", replaces cells which are empty or only
+	// whitespace.
+	Empty string
+
+	// Color is an ANSI SGR escape sequence for the column's cells,
+	// or "" to leave them uncolored.
+	Color string
+
+	// Case is upper, lower or title to change the case of the
+	// column's rendered cells, or "" to leave them alone.
+	Case string
+
+	// Fill, if not "", pads the column's cells instead of
+	// Options.FillChar.  It's a single character, one column wide.
+	Fill string
+
+	// explicitAlign is true if the spec chose an alignment, rather
+	// than accepting its type's default
+	explicitAlign bool
+}
+
+// HeatBand colors numeric values at or above Threshold.
+type HeatBand struct {
+	Threshold float64
+
+	// Color is an ANSI SGR escape sequence
+	Color string
+}
+
+// DefaultColumn is the key of a spec, written as "default" in a column
+// spec, which applies to every column without a spec of its own.
+const DefaultColumn = math.MinInt32
+
+// NewColumnSpec returns a spec for a left-aligned string column
+// without any width limits, showing numbers with as many decimal
+// places as necessary.  It sets WidthMax and Decimals to -1, so
+// callers building a ColumnSpec literal must do the same.
+func NewColumnSpec() *ColumnSpec {
+	return &ColumnSpec{WidthMax: -1, Decimals: -1}
+}
+
+// weight returns the spec's Weight, applying the default.
+func (spec *ColumnSpec) weight() int {
+	if spec.Weight < 1 {
+		return 1
+	}
+	return spec.Weight
 }
 
 func (spec *ColumnSpec) HasFlexibleWidth() bool {
@@ -51,265 +263,3294 @@ func (spec *ColumnSpec) HasFlexibleWidth() bool {
 	return false
 }
 
-var terminalWidth = 0
-var isDebug = false
+// Version identifies this build of colfmt.  Release builds set it with
+// -ldflags "-X github.com/mndrix/colfmt.Version=1.2.3"
+var Version = "devel"
+
+var overflowMarker = "»"
+var specBlockSentinel = "---"
+
+const defaultDateLayout = "2006-01-02 15:04"
+
+// env holds the settings which one call of Run, RenderRows or Format
+// shares with the functions it calls.  each call has its own, so
+// concurrent calls don't interfere
+type env struct {
+	// ignore ANSI escape sequences when measuring and truncating text
+	ansiAware bool
 
+	// where warnings and, with isDebug, debug messages go.  nil
+	// discards them
+	messages io.Writer
+	isDebug  bool
+
+	// how cells are rendered.  see the Options fields of the same
+	// names
+	dateLayout  string
+	boolGlyphs  [2]string
+	ageScale    AgeScale
+	timeLayouts []string
+
+	// returns the time ages are measured from
+	now func() time.Time
+}
+
+// Main runs colfmt as a command, exiting when it's done.
 func Main() {
+	os.Exit(Run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// Run formats columns read from stdin according to args, which exclude
+// the program name.  Formatted output goes to stdout and messages go to
+// errOutput.  Returns the command's exit code.
+func Run(args []string, stdin io.Reader, stdout, errOutput io.Writer) int {
+	e := &env{
+		messages:   errOutput,
+		dateLayout: defaultDateLayout,
+		boolGlyphs: defaultBoolGlyphs,
+		ageScale:   defaultAgeScale,
+		now:        time.Now,
+	}
+
 	var inputRecordSeparator byte = '\n'
-	var inputFieldSeparator byte = '\t'
+	inputFieldSeparator := "\t"
 	outputRecordSeparator := "\n"
 	outputFieldSeparator := "  "
 
 	// how wide is the user's terminal?
-	if width, _, err := terminal.GetSize(int(os.Stdout.Fd())); err == nil {
-		terminalWidth = width
-	} else {
-		debug("Can't get terminal dimensions: %s", err)
+	terminalWidth := 0
+	isTerminal := false
+	if file, ok := stdout.(*os.File); ok {
+		if width, _, err := terminal.GetSize(int(file.Fd())); err == nil {
+			terminalWidth = width
+			isTerminal = true
+		} else {
+			e.debug("Can't get terminal dimensions: %s", err)
+		}
+	}
+	if !isTerminal {
+		// shells export the width of the terminal, which outlasts
+		// pipes to a pager
+		if width, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && width > 0 {
+			terminalWidth = width
+		}
 	}
 
 	// parse flags
-	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
-	fs.BoolVar(&isDebug, "D", false, "send debug messages to stderr")
-	fs.IntVar(&terminalWidth, "w", terminalWidth, "assume the terminal is this wide")
-	fs.Parse(os.Args[1:])
+	fs := flag.NewFlagSet("colfmt", flag.ContinueOnError)
+	fs.SetOutput(errOutput)
+	fs.BoolVar(&e.isDebug, "D", false, "send debug messages to stderr")
+	var showVersion bool
+	fs.BoolVar(&showVersion, "V", false, "print the version and exit")
+	fs.BoolVar(&showVersion, "version", false, "same as -V")
+	fs.IntVar(&terminalWidth, "w", terminalWidth, "assume the terminal is this wide (default is the terminal's width, or $COLUMNS when not writing to a terminal)")
+	alignWith := fs.String("align-with", "", "also measure column widths from this file")
+	clip := fs.Bool("clip", false, "clip lines which are wider than the terminal")
+	markOverflow := fs.Bool("mark-overflow", false, "clip lines which are wider than the terminal, ending them with "+overflowMarker)
+	specBlock := fs.Bool("spec-block", false, "read the column spec from the start of the input, up to a line containing "+specBlockSentinel+", instead of the first argument")
+	specFile := fs.String("spec-file", "", "read the column spec from this file when there's no spec argument")
+	shuffle := fs.Bool("shuffle", false, "output rows in random order")
+	numberRows := fs.Bool("n", false, "number the rows in a new first column.  column specs keep referring to input column numbers")
+	total := fs.Bool("total", false, "append a row summarizing each column, by summing num columns or as chosen by total: in the spec")
+	sortColumn := fs.Int("sort", 0, "sort rows by the text of this column, keeping the header on top")
+	reverse := fs.Bool("reverse", false, "with -sort, sort rows in descending order")
+	sortNumeric := fs.Bool("sort-numeric", false, "with -sort, compare cells as numbers.  num, age, date and duration columns always compare their values")
+	seed := fs.Int64("seed", 0, "seed for -shuffle, to make its order reproducible")
+	runningTotal := fs.Int("running-total", 0, "append a column with the running total of this column")
+	maxFields := fs.Int("max-fields", -1, "split records into at most this many fields; the last field keeps any remaining separators, though -tabs still rewrites tab separators")
+	pagerMode := fs.String("pager-mode", "wrap", "how output will be paged: wrap (shrink columns to fit the terminal) or chop (keep widths and -mark-overflow). either way, -w sets the terminal width that columns shrink to or lines are clipped at")
+	merge := fs.String("merge", "", "merge a range of columns like 2-4 into one column, joined by the text after an optional colon like 2-4:/")
+	tabs := fs.String("tabs", "replace:1", "handle tabs inside fields: error, keep (leave them, though they'll spoil alignment), replace:N (with N spaces) or expand:N (to tab stops every N columns, default 8)")
+	paginate := fs.Bool("paginate", false, "instead of shrinking columns, print groups of columns which fit the terminal one after another")
+	keyColumn := fs.Int("key-column", 0, "with -paginate, repeat this column on every page")
+	stable := fs.Bool("stable", false, "fail if any option other than -sort would change the order of rows")
+	controls := fs.String("control", "keep", "handle control characters, like carriage returns, inside fields: keep, escape (show them like ^M) or strip.  tabs are handled by -tabs")
+	trim := fs.Bool("trim", false, "remove whitespace surrounding each cell, leaving cells of only whitespace empty")
+	emptyCell := fs.String("empty", "", "show cells which are empty or only whitespace as this text, like -")
+	emptyMessage := fs.String("empty-message", "", "print this message when there are no rows")
+	quoteOutput := fs.Bool("quote-output", false, "quote cells which contain the output field or record separator, a double quote or surrounding whitespace")
+	outputFormat := fs.String("output", "table", "output format: table (aligned columns), csv (RFC 4180, without alignment) or markdown")
+	cols := fs.String("cols", "", "output only these columns, in this order, like 3,1.  column specs keep referring to input column numbers")
+	stream := fs.Bool("stream", false, "print each record as soon as it's read, for unbounded input.  every column needs a fixed width like 8c, since measuring columns needs every record")
+	transpose := fs.Bool("transpose", false, "swap rows and columns, so each field becomes a row.  with -H, the header becomes the first column.  column specs refer to the swapped columns")
+	padRagged := fs.Bool("p", false, "pad records which have too few fields with empty fields, instead of failing")
+	var ellipsis string
+	fs.StringVar(&ellipsis, "e", "…", "indicate truncated cells with this text")
+	fs.StringVar(&ellipsis, "ellipsis", "…", "same as -e")
+	hasHeader := fs.Bool("H", false, "the first record is a header, which is never truncated, except to the fixed widths of -stream")
+	repeatHeader := fs.Int("repeat-header", 0, "with -H, print the header again before every N records")
+	fieldSeparator := fs.String("F", "\t", "input field separator, which may be several bytes like ' | '")
+	csvInput := fs.Bool("csv", false, "input is CSV, with quoted fields as in RFC 4180 (can't be used with -F)")
+	autoSeparator := fs.Bool("auto", false, "choose the input field separator, among tab, comma and pipe, which splits the first records into the same number of fields")
+	positions := fs.String("positions", "", "split records into fields at fixed character positions, like 0-10,10-25,25- where each range excludes its last position and an open range extends to the end of the record")
+	splitRegex := fs.String("split-regex", "", "split records into fields on matches of this regular expression, like awk's FS.  separators at the start or end of a record are ignored")
+	fs.StringVar(&outputFieldSeparator, "O", outputFieldSeparator, "output field separator")
+	nulRecords := fs.Bool("0", false, "input and output records are separated by NUL bytes")
+	shrink := fs.String("shrink", "widest", "how to shrink columns to fit the terminal: widest (shrink the widest column first) or proportional (shrink every column by a share of its excess width)")
+	trimTrailing := fs.Bool("trim-trailing", false, "don't pad the end of each line with spaces")
+	fill := fs.Bool("fill", false, "widen flexible columns to fill the terminal")
+	fillChar := fs.String("fill-char", " ", "pad cells with this character, like . for dot leaders.  fill: in the spec chooses one for a column")
+	zebra := fs.Bool("zebra", false, "dim every other row, when output is colored")
+	colorMode := fs.String("color", "auto", "when to color output: always, never or auto (when writing to a terminal and NO_COLOR isn't set)")
+	glyphs := fs.String("bool-glyphs", strings.Join(e.boolGlyphs[:], ","), "how bool columns show true and false values, separated by a comma")
+	fs.BoolVar(&e.ansiAware, "ansi", false, "ignore ANSI escape sequences in the input when measuring and truncating cells")
+	nowTime := fs.String("now", "", "measure ages from this time instead of the current time, for reproducible output")
+	fs.StringVar(&e.dateLayout, "date-layout", e.dateLayout, "Go reference time layout for date columns")
+	ageTiers := fs.String("age-units", "", "units for age columns with the limit at which each gives way to the next, like s:90,m:90,h:24,d:30,M:12 (overrides -age-weeks)")
+	ageWeeks := fs.Bool("age-weeks", true, "show ages between 14 and 60 days in weeks")
+	fs.BoolVar(&e.ageScale.ShowYear, "age-year", e.ageScale.ShowYear, "show ages beyond the largest unit as a year")
+	fs.Var((*stringList)(&e.timeLayouts), "time-layout", "also parse timestamps with this layout, written as Go's reference time Mon Jan 2 15:04:05 MST 2006 (repeatable)")
+	if err := fs.Parse(args); err == flag.ErrHelp {
+		return 0
+	} else if err != nil {
+		return 2
+	}
+	if showVersion {
+		fmt.Fprintf(stdout, "colfmt %s\n", Version)
+		return 0
+	}
+	useColor, err := colorEnabled(*colorMode, isTerminal)
+	if err != nil {
+		return e.die("parsing -color: %s", err)
+	}
+	if *nowTime != "" {
+		t, err := e.parseTime(*nowTime)
+		if err != nil {
+			return e.die("parsing -now: %s", err)
+		}
+		e.now = func() time.Time { return t }
+	}
+	parts := strings.Split(*glyphs, ",")
+	if len(parts) != 2 {
+		return e.die("-bool-glyphs needs two glyphs separated by a comma: %q", *glyphs)
+	}
+	e.boolGlyphs = [2]string{parts[0], parts[1]}
+	if *ageTiers != "" {
+		tiers, err := parseAgeTiers(*ageTiers)
+		if err != nil {
+			return e.die("parsing -age-units: %s", err)
+		}
+		e.ageScale.Tiers = tiers
+	} else if !*ageWeeks {
+		e.ageScale.Tiers = ageTiersWithoutWeeks
+	}
+	if *nulRecords {
+		inputRecordSeparator = 0
+		outputRecordSeparator = "\x00"
+	}
+	if *fieldSeparator == "" {
+		return e.die("-F can't be empty")
+	}
+	inputFieldSeparator = *fieldSeparator
+	if *csvInput && isFlagSet(fs, "F") {
+		return e.die("can't use both -csv and -F")
+	}
+	if *maxFields == 0 || *maxFields < -1 {
+		return e.die("-max-fields must be positive: %d", *maxFields)
+	}
+	split := splitOn(inputFieldSeparator, *maxFields)
+	if *splitRegex != "" {
+		if *csvInput || isFlagSet(fs, "F") {
+			return e.die("can't use -split-regex with -csv or -F")
+		}
+		re, err := regexp.Compile(*splitRegex)
+		if err != nil {
+			return e.die("parsing -split-regex: %s", err)
+		}
+		split = splitRegexp(re, *maxFields)
+	}
+	if *positions != "" {
+		if *csvInput || isFlagSet(fs, "F") || *splitRegex != "" {
+			return e.die("can't use -positions with -csv, -F or -split-regex")
+		}
+		ranges, err := parsePositions(*positions)
+		if err != nil {
+			return e.die("parsing -positions: %s", err)
+		}
+		split = splitAt(ranges)
+	}
+	if *autoSeparator && (*csvInput || isFlagSet(fs, "F") || *splitRegex != "" || *positions != "") {
+		return e.die("can't use -auto with -csv, -F, -split-regex or -positions")
+	}
+	tabHandling, err := parseTabPolicy(*tabs)
+	if err != nil {
+		return e.die("parsing -tabs: %s", err)
+	}
+	var mergeFirst, mergeLast int
+	var mergeJoiner string
+	if *merge != "" {
+		mergeFirst, mergeLast, mergeJoiner, err = parseMerge(*merge)
+		if err != nil {
+			return e.die("parsing -merge: %s", err)
+		}
+	}
+	rebalance := true
+	switch *pagerMode {
+	case "wrap":
+	case "chop":
+		rebalance = false
+		*markOverflow = true
+	default:
+		return e.die("unknown -pager-mode: %s", *pagerMode)
+	}
+	if *paginate {
+		rebalance = false
+	}
+	switch *controls {
+	case "keep", "escape", "strip":
+	default:
+		return e.die("unknown -control: %s", *controls)
+	}
+	switch *shrink {
+	case "widest", "proportional":
+	default:
+		return e.die("unknown -shrink: %s", *shrink)
+	}
+	switch *outputFormat {
+	case "table", "csv", "markdown":
+	default:
+		return e.die("unknown -output format: %s", *outputFormat)
+	}
+	if *outputFormat != "table" && *quoteOutput {
+		return e.die("%s output does its own quoting; can't use -quote-output", *outputFormat)
+	}
+	var projection []int
+	if *cols != "" {
+		projection, err = parseColumnList(*cols)
+		if err != nil {
+			return e.die("parsing -cols: %s", err)
+		}
+	}
+	if *sortColumn < 0 {
+		return e.die("-sort must be a column number: %d", *sortColumn)
+	}
+	if *sortColumn > 0 && *shuffle {
+		return e.die("can't use both -sort and -shuffle")
+	}
+	if *stable && *shuffle {
+		return e.die("-shuffle reorders rows, which -stable forbids")
+	}
+	if !isFillChar(*fillChar) {
+		return e.die("-fill-char must be a single character, one column wide: %q", *fillChar)
+	}
+	if *specFile != "" && *specBlock {
+		return e.die("can't use both -spec-file and -spec-block")
+	}
+	if *repeatHeader < 0 {
+		return e.die("-repeat-header must be positive: %d", *repeatHeader)
+	}
+	if *repeatHeader > 0 && !*hasHeader {
+		return e.die("-repeat-header needs -H")
+	}
+	if *transpose && *alignWith != "" {
+		return e.die("can't use both -transpose and -align-with")
+	}
 
-	// parse column specification
+	// parse column specification.  remaining arguments name input
+	// files.  without a spec argument, the spec comes from -spec-file
+	// or else $COLFMT_SPEC
 	rawSpec := ""
-	if args := fs.Args(); len(args) > 0 {
-		rawSpec = args[0]
+	names := fs.Args()
+	switch {
+	case *specBlock:
+	case len(names) > 0:
+		rawSpec, names = names[0], names[1:]
+	case *specFile != "":
+		content, err := ioutil.ReadFile(*specFile)
+		if err != nil {
+			return e.die("reading spec file: %s", err)
+		}
+		rawSpec = string(content)
+	default:
+		rawSpec = os.Getenv("COLFMT_SPEC")
+	}
+	var inputs []io.Reader
+	for _, name := range names {
+		if name == "-" {
+			inputs = append(inputs, stdin)
+			continue
+		}
+		file, err := os.Open(name)
+		if err != nil {
+			return e.die("opening input: %s", err)
+		}
+		defer file.Close()
+		inputs = append(inputs, file)
+	}
+	if len(inputs) == 0 {
+		inputs = []io.Reader{stdin}
+	}
+	if *specBlock {
+		rawSpec, inputs[0], err = readSpecBlock(inputs[0])
+		if err != nil {
+			return e.die("reading spec block: %s", err)
+		}
 	}
-	specs, err := ParseColumnSpecs(rawSpec)
+	if *autoSeparator {
+		var separator byte
+		separator, inputs[0], err = detectSeparator(inputs[0], inputRecordSeparator)
+		if err != nil {
+			return e.die("choosing field separator: %s", err)
+		}
+		e.debug("chose field separator %q", separator)
+		inputFieldSeparator = string(separator)
+		split = splitOn(inputFieldSeparator, *maxFields)
+	}
+	specs, named, err := e.parseColumnSpecs(rawSpec)
 	if err != nil {
-		die("parsing column spec: %s", err)
+		return e.die("parsing column spec: %s", err)
+	}
+	if len(named) > 0 && (!*hasHeader || *transpose) {
+		return e.die("columns chosen by name need -H, without -transpose")
+	}
+	if e.isDebug {
+		keys := make([]int, 0, len(specs))
+		for i := range specs {
+			keys = append(keys, i)
+		}
+		sort.Ints(keys)
+		for _, i := range keys {
+			e.debug("spec %d: %+v", i, *specs[i])
+		}
+	}
+
+	scan := func(r io.Reader, fn func([]string) error) error {
+		if *csvInput {
+			return scanCSVRows(r, fn)
+		}
+		return scanRows(r, inputRecordSeparator, split, fn)
+	}
+	read := func(r io.Reader) ([][]string, error) {
+		var rows [][]string
+		err := scan(r, func(row []string) error {
+			rows = append(rows, row)
+			return nil
+		})
+		return rows, err
+	}
+
+	// specs follow their input columns into the output, once the
+	// number of columns is known
+	var outputSpecs map[int]*ColumnSpec
+	resolveColumns := func(columns int) error {
+		var err error
+		specs, err = resolveSpecs(specs, columns)
+		outputSpecs = specs
+		if projection != nil {
+			outputSpecs = projectSpecs(specs, projection)
+		}
+		return err
 	}
-	/*
-		fmt.Fprintf(os.Stderr, "specs = ")
-		for i, spec := range specs {
-			fmt.Fprintf(os.Stderr, "%d: %+v ", i, spec)
+
+	// format each row as it arrives, with widths fixed by the spec
+	if *stream {
+		if *shuffle || *sortColumn > 0 || *total || *numberRows || *alignWith != "" || *paginate || *runningTotal > 0 || *padRagged || *transpose || *outputFormat != "table" {
+			return e.die("-stream can't be used with options which need every record first")
+		}
+		for _, spec := range specs {
+			if spec.Delta {
+				return e.die("-stream can't be used with delta columns")
+			}
+			if spec.Type == TypeBar && spec.BarTarget <= 0 {
+				return e.die("-stream can't scale bars to their largest value; use bar:target=N")
+			}
+		}
+		if *zebra {
+			return e.die("-stream can't be used with -zebra")
+		}
+		opts := Options{
+			TerminalWidth:   terminalWidth,
+			FieldSeparator:  outputFieldSeparator,
+			RecordSeparator: outputRecordSeparator,
+			Ellipsis:        ellipsis,
+			Clip:            *clip,
+			MarkOverflow:    *markOverflow,
+			Color:           useColor,
+			TrimTrailing:    *trimTrailing,
+			FillChar:        *fillChar,
+		}
+		isHeader := *hasHeader
+		var header []string
+		count := 0
+		for _, input := range inputs {
+			err := scan(input, func(row []string) error {
+				rows := [][]string{row}
+				if *merge != "" {
+					if err := mergeColumns(rows, mergeFirst, mergeLast, mergeJoiner); err != nil {
+						return err
+					}
+				}
+				if err := tabHandling.applyRows(rows); err != nil {
+					return err
+				}
+				if opts.Widths == nil {
+					var err error
+					specs, err = bindNames(specs, named, rows[0])
+					if err != nil {
+						return err
+					}
+					if err := resolveColumns(len(rows[0])); err != nil {
+						return err
+					}
+				}
+				e.cleanControls(rows, *controls)
+				trimCells(rows, specs, *trim)
+				if projection != nil {
+					if err := projectColumns(rows, projection); err != nil {
+						return err
+					}
+				}
+				if opts.Widths == nil {
+					resolved := resolvePercentWidths(outputSpecs, terminalWidth)
+					widths, err := fixedWidths(len(rows[0]), resolved)
+					if err != nil {
+						return err
+					}
+					opts.Widths = widths
+				}
+				if isHeader {
+					isHeader = false
+					if *quoteOutput {
+						quoteRows(rows, outputFieldSeparator, outputRecordSeparator)
+					}
+					header = rows[0]
+					opts.Header, rows = header, nil
+				} else {
+					e.renderRows(rows, outputSpecs)
+					fillEmptyCells(rows, outputSpecs, *emptyCell)
+					if *quoteOutput {
+						quoteRows(rows, outputFieldSeparator, outputRecordSeparator)
+					}
+					opts.Header = nil
+					if *repeatHeader > 0 && count > 0 && count%*repeatHeader == 0 {
+						opts.Header = header
+					}
+					count++
+				}
+				return e.format(stdout, rows, outputSpecs, opts)
+			})
+			if err != nil {
+				return e.die("%s", err)
+			}
+		}
+		if opts.Widths == nil && *emptyMessage != "" {
+			io.WriteString(stdout, *emptyMessage+outputRecordSeparator)
 		}
-		fmt.Fprintf(os.Stderr, "\n")
-	*/
+		return 0
+	}
 
 	// collect rows
 	var rows [][]string
-	s := bufio.NewScanner(os.Stdin)
-	s.Split(on(inputRecordSeparator))
-	for s.Scan() {
-		line := s.Bytes()
-		columns := bytes.Split(line, []byte{inputFieldSeparator})
-		strs := make([]string, len(columns))
-		for i, column := range columns {
-			strs[i] = string(column) // copy, since scanner reuses byte array
-			if spec, ok := specs[i]; ok && spec.Type == TypeAge {
-				original := strs[i]
-				strs[i], err = renderAge(original)
-				if err != nil {
-					warn("Unexpected date format: %q", original)
-				}
+	for _, input := range inputs {
+		more, err := read(input)
+		if err != nil {
+			return e.die("reading line: %s", err)
+		}
+		rows = append(rows, more...)
+	}
+	var headerRows [][]string
+	if *hasHeader && len(rows) > 0 {
+		headerRows, rows = [][]string{rows[0]}, rows[1:]
+	}
+	if len(rows) == 0 && headerRows == nil {
+		if *emptyMessage != "" {
+			io.WriteString(stdout, *emptyMessage+outputRecordSeparator)
+		}
+		return 0
+	}
+	if *transpose {
+		rows = transposeRows(append(headerRows, rows...))
+		headerRows = nil
+	}
+
+	// collect rows whose widths should be shared with this table
+	var reference [][]string
+	if *alignWith != "" {
+		file, err := os.Open(*alignWith)
+		if err != nil {
+			return e.die("opening reference file: %s", err)
+		}
+		reference, err = read(file)
+		file.Close()
+		if err != nil {
+			return e.die("reading reference file: %s", err)
+		}
+		if *hasHeader && len(reference) > 0 {
+			reference = reference[1:]
+		}
+	}
+
+	// restructure columns
+	if *padRagged {
+		padRows(headerRows, rows, reference)
+	}
+	if *merge != "" {
+		for _, rows := range [][][]string{headerRows, rows, reference} {
+			if err := mergeColumns(rows, mergeFirst, mergeLast, mergeJoiner); err != nil {
+				return e.die("%s", err)
 			}
 		}
-		rows = append(rows, strs)
 	}
-	if err := s.Err(); err != nil {
-		die("reading line: %s", err)
+	columns := rows
+	if headerRows != nil {
+		columns = headerRows
+		specs, err = bindNames(specs, named, headerRows[0])
+		if err != nil {
+			return e.die("%s", err)
+		}
 	}
-	if len(rows) == 0 {
-		return
+	if err := resolveColumns(len(columns[0])); err != nil {
+		return e.die("%s", err)
+	}
+	if err := tabHandling.applyRows(headerRows); err != nil {
+		return e.die("header %s", err)
+	}
+	if err := tabHandling.applyRows(rows); err != nil {
+		return e.die("%s", err)
+	}
+	if err := tabHandling.applyRows(reference); err != nil {
+		return e.die("reference file %s", err)
+	}
+	for _, rows := range [][][]string{headerRows, rows, reference} {
+		e.cleanControls(rows, *controls)
+		trimCells(rows, specs, *trim)
 	}
 
-	// calculate column widths
-	widths := make([]int, len(rows[0]))
-	for _, row := range rows {
-		if len(row) != len(widths) {
-			die("Not all records have the same number of fields")
+	// sort by the values before they're rendered.  headers stay on top
+	if *sortColumn > 0 {
+		key := e.sortKey(specs[*sortColumn-1], *sortNumeric)
+		if err := sortRows(rows, *sortColumn-1, *reverse, key); err != nil {
+			return e.die("%s", err)
 		}
-		for j, column := range row {
-			if len(column) > widths[j] {
-				widths[j] = len(column)
+	}
+	var summary []string
+	if *total || hasTotals(specs) {
+		summary = e.summarizeRows(rows, specs, len(columns[0]))
+		for i, cell := range summary {
+			if spec, ok := specs[i]; ok && cell != "" && spec.Total != "count" {
+				summary[i] = e.renderCell(cell, spec)
+			}
+		}
+	}
+	e.renderRows(rows, specs)
+	e.renderRows(reference, specs)
+
+	// reorder rows, if requested.  headers stay on top
+	if *shuffle {
+		if *seed == 0 {
+			*seed = time.Now().UnixNano()
+		}
+		r := rand.New(rand.NewSource(*seed))
+		r.Shuffle(len(rows), func(i, j int) {
+			rows[i], rows[j] = rows[j], rows[i]
+		})
+	}
+
+	// compare rows with their predecessors
+	e.renderDeltas(rows, specs)
+	e.renderDeltas(reference, specs)
+
+	// synthesize columns.  projection keeps them after the columns it
+	// chooses
+	if *runningTotal > 0 {
+		totalColumn := len(columns[0])
+		for _, rows := range [][][]string{rows, reference} {
+			if err := e.appendRunningTotal(rows, *runningTotal-1, specs[*runningTotal-1]); err != nil {
+				return e.die("%s", err)
+			}
+		}
+		for i := range headerRows {
+			headerRows[i] = append(headerRows[i], "total")
+		}
+		totals := NewColumnSpec()
+		totals.Align = AlignRight
+		specs[totalColumn] = totals
+		if projection != nil {
+			if projectedColumn(totalColumn+1, projection) == 0 {
+				projection = append(projection, totalColumn)
+			}
+			outputSpecs = projectSpecs(specs, projection)
+		}
+	}
+	fillEmptyCells(rows, specs, *emptyCell)
+	fillEmptyCells(reference, specs, *emptyCell)
+	if summary != nil {
+		if *runningTotal > 0 {
+			summary = append(summary, "")
+		}
+		rows = append(rows, summary)
+	}
+	if projection != nil {
+		for _, rows := range [][][]string{headerRows, rows, reference} {
+			if err := projectColumns(rows, projection); err != nil {
+				return e.die("%s", err)
+			}
+		}
+	}
+	key := projectedColumn(*keyColumn, projection)
+	if *numberRows {
+		labels := make([]string, len(rows))
+		for i := range labels {
+			labels[i] = strconv.Itoa(i + 1)
+		}
+		if summary != nil {
+			labels[len(labels)-1] = ""
+		}
+		prependColumn(headerRows, func(int) string { return "#" })
+		prependColumn(rows, func(i int) string { return labels[i] })
+		prependColumn(reference, func(int) string { return "" })
+
+		numbers := NewColumnSpec()
+		numbers.Align = AlignRight
+		outputSpecs = shiftSpecs(outputSpecs, 1)
+		outputSpecs[0] = numbers
+		if key > 0 {
+			key++
+		}
+	}
+
+	if *outputFormat == "csv" {
+		if err := writeCSVRows(stdout, outputSpecs, headerRows, rows); err != nil {
+			return e.die("writing CSV: %s", err)
+		}
+		return 0
+	}
+	if *outputFormat == "markdown" {
+		var header []string
+		if headerRows != nil {
+			header = headerRows[0]
+		}
+		if err := writeMarkdown(stdout, header, rows, outputSpecs); err != nil {
+			return e.die("writing Markdown: %s", err)
+		}
+		return 0
+	}
+
+	// quote cells once nothing else needs to parse them
+	if *quoteOutput {
+		quoteRows(headerRows, outputFieldSeparator, outputRecordSeparator)
+		quoteRows(rows, outputFieldSeparator, outputRecordSeparator)
+		quoteRows(reference, outputFieldSeparator, outputRecordSeparator)
+	}
+
+	// format the table
+	opts := Options{
+		TerminalWidth:   terminalWidth,
+		FieldSeparator:  outputFieldSeparator,
+		RecordSeparator: outputRecordSeparator,
+		Ellipsis:        ellipsis,
+		Reference:       reference,
+		Rebalance:       rebalance,
+		Proportional:    *shrink == "proportional",
+		Fill:            *fill,
+		Paginate:        *paginate,
+		KeyColumn:       key,
+		Clip:            *clip,
+		MarkOverflow:    *markOverflow,
+		Color:           useColor,
+		Zebra:           *zebra,
+		TrimTrailing:    *trimTrailing,
+		EmptyMessage:    *emptyMessage,
+		RepeatHeader:    *repeatHeader,
+		FillChar:        *fillChar,
+	}
+	if headerRows != nil {
+		opts.Header = headerRows[0]
+	}
+	if err := e.format(stdout, rows, outputSpecs, opts); err != nil {
+		return e.die("%s", err)
+	}
+	return 0
+}
+
+// decides whether to emit ANSI color sequences.  mode is always, never
+// or auto.  auto colors output to a terminal unless the NO_COLOR
+// environment variable is set
+func colorEnabled(mode string, isTerminal bool) (bool, error) {
+	switch mode {
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	case "auto":
+		_, noColor := os.LookupEnv("NO_COLOR")
+		return isTerminal && !noColor, nil
+	}
+	return false, fmt.Errorf("unknown mode: %s", mode)
+}
+
+// Options controls how RenderRows renders cells and how Format lays
+// them out in a table.
+type Options struct {
+	// TerminalWidth is the horizontal space available for the table.
+	TerminalWidth int
+
+	// FieldSeparator goes between columns.
+	FieldSeparator string
+
+	// RecordSeparator ends each line.
+	RecordSeparator string
+
+	// Ellipsis marks cells which had to be truncated.
+	Ellipsis string
+
+	// Header, if not nil, is printed above the rows.  Columns are
+	// always wide enough to show their header without truncation,
+	// even if that exceeds the column's WidthMax.
+	Header []string
+
+	// Reference rows aren't printed, but columns are made wide enough
+	// to hold them.
+	Reference [][]string
+
+	// Rebalance shrinks flexible columns until the table fits within
+	// TerminalWidth.
+	Rebalance bool
+
+	// Proportional makes Rebalance shrink every flexible column in
+	// proportion to its excess width, instead of repeatedly shrinking
+	// the widest.
+	Proportional bool
+
+	// Fill grows flexible columns until the table is as wide as
+	// TerminalWidth.
+	Fill bool
+
+	// Paginate prints groups of columns which fit within
+	// TerminalWidth, one after another.
+	Paginate bool
+
+	// KeyColumn is the 1-based number of a column to repeat on every
+	// page when paginating.  0 means none.
+	KeyColumn int
+
+	// Clip cuts lines which are wider than TerminalWidth.
+	Clip bool
+
+	// MarkOverflow clips lines like Clip, marking the clipped lines.
+	MarkOverflow bool
+
+	// Color allows ANSI color sequences in the output.
+	Color bool
+
+	// TrimTrailing leaves the last column unpadded on the right, so
+	// lines don't end with padding.
+	TrimTrailing bool
+
+	// Zebra dims every other row, starting with the second row after
+	// the header, when Color is enabled.
+	Zebra bool
+
+	// EmptyMessage is printed after the header when there are no
+	// rows.
+	EmptyMessage string
+
+	// FillChar pads cells to their column's width, like . for dot
+	// leaders.  "" means a space.  Headers are always padded with
+	// spaces.
+	FillChar string
+
+	// RepeatHeader, if positive, prints Header again before every
+	// RepeatHeader rows.
+	RepeatHeader int
+
+	// Widths, if not nil, fixes the width of each column instead of
+	// measuring the cells.  Headers are truncated like other cells.
+	Widths []int
+
+	// ANSI ignores ANSI escape sequences in cells when measuring and
+	// truncating them, so colored cells line up.
+	ANSI bool
+
+	// Messages receives warnings, like those about cells which can't
+	// be rendered.  nil discards them.
+	Messages io.Writer
+
+	// Debug sends messages about how column widths were chosen to
+	// Messages.
+	Debug bool
+
+	// DateLayout is the Go reference time layout for date columns
+	// without a layout of their own.  "" means "2006-01-02 15:04".
+	DateLayout string
+
+	// BoolGlyphs show true and false values in bool columns.  The
+	// zero value means ✓ and ✗.
+	BoolGlyphs [2]string
+
+	// AgeScale describes how age columns are shown.  nil means
+	// seconds through months, followed by the timestamp's year.
+	AgeScale *AgeScale
+
+	// TimeLayouts are tried, before the built-in layouts, when
+	// parsing timestamps.
+	TimeLayouts []string
+
+	// Now is the time ages are measured from.  The zero time means
+	// the current time.
+	Now time.Time
+}
+
+// returns the settings which opts gives the functions called by
+// RenderRows and Format
+func (opts *Options) env() *env {
+	e := &env{
+		ansiAware:   opts.ANSI,
+		messages:    opts.Messages,
+		isDebug:     opts.Debug,
+		dateLayout:  opts.DateLayout,
+		boolGlyphs:  opts.BoolGlyphs,
+		ageScale:    defaultAgeScale,
+		timeLayouts: opts.TimeLayouts,
+		now:         time.Now,
+	}
+	if e.dateLayout == "" {
+		e.dateLayout = defaultDateLayout
+	}
+	if e.boolGlyphs == [2]string{} {
+		e.boolGlyphs = defaultBoolGlyphs
+	}
+	if opts.AgeScale != nil {
+		e.ageScale = *opts.AgeScale
+	}
+	if t := opts.Now; !t.IsZero() {
+		e.now = func() time.Time { return t }
+	}
+	return e
+}
+
+// Format writes rows to w as an aligned table, laid out according to
+// specs and opts.  Cells should already be rendered (see RenderRows).
+func Format(w io.Writer, rows [][]string, specs map[int]*ColumnSpec, opts Options) error {
+	return opts.env().format(w, rows, specs, opts)
+}
+
+// like Format, with settings from e instead of opts
+func (e *env) format(w io.Writer, rows [][]string, specs map[int]*ColumnSpec, opts Options) error {
+	var headerRows [][]string
+	if opts.Header != nil {
+		headerRows = [][]string{opts.Header}
+	}
+	output := append(headerRows, rows...)
+	if len(output) == 0 {
+		if opts.EmptyMessage != "" {
+			_, err := io.WriteString(w, opts.EmptyMessage+opts.RecordSeparator)
+			return err
+		}
+		return nil
+	}
+	specs, err := resolveSpecs(specs, len(output[0]))
+	if err != nil {
+		return err
+	}
+	rows, opts.Reference = e.alignDecimals(rows, opts.Reference, specs)
+	output = append(headerRows, rows...)
+
+	widths := opts.Widths
+	if widths == nil {
+		var err error
+		widths, err = e.columnWidths(headerRows, rows, specs, opts)
+		if err != nil {
+			return err
+		}
+	} else {
+		for _, row := range output {
+			if len(row) != len(widths) {
+				return errors.New("Not all records have the same number of fields")
 			}
 		}
 	}
+	gutter := e.displayWidth(opts.FieldSeparator)
+
+	// group columns into pages
+	var pages [][]int
+	if opts.Paginate {
+		pages = paginateColumns(widths, opts.KeyColumn-1, opts.TerminalWidth, gutter)
+	} else {
+		page := make([]int, len(widths))
+		for i := range page {
+			page[i] = i
+		}
+		pages = [][]int{page}
+	}
+
+	// output formatted data
+	// bars without a target are scaled to their column's largest value
+	barMax := make(map[int]float64)
+	for i, spec := range specs {
+		if spec.Type != TypeBar || spec.BarTarget > 0 {
+			continue
+		}
+		for _, row := range rows {
+			if i >= len(row) {
+				continue
+			}
+			if value, err := parseNumber(row[i]); err == nil && value > barMax[i] {
+				barMax[i] = value
+			}
+		}
+	}
+
+	// repeat headers among the rows.  rank holds each output row's
+	// position among rows, or -1 for a header
+	output = nil
+	var rank []int
+	addHeaders := func() {
+		for _, header := range headerRows {
+			output = append(output, header)
+			rank = append(rank, -1)
+		}
+	}
+	addHeaders()
+	for i, row := range rows {
+		if opts.RepeatHeader > 0 && i > 0 && i%opts.RepeatHeader == 0 {
+			addHeaders()
+		}
+		output = append(output, row)
+		rank = append(rank, i)
+	}
+
+	// buffer output, since tables often have many short lines
+	out := bufio.NewWriter(w)
+	columns := make([]string, 0, len(widths))
+	cells := make([][]string, 0, len(widths))
+	blanks := make([]string, 0, len(widths))
+	lines := make([]string, len(widths)) // cells of one line, reused for each row
+	for p, page := range pages {
+		if p > 0 {
+			if _, err := out.WriteString(opts.RecordSeparator); err != nil {
+				return err
+			}
+		}
+		// with TrimTrailing, the last column on the page isn't padded
+		// on the right
+		last := -1
+		if opts.TrimTrailing {
+			for _, i := range page {
+				if widths[i] > 0 {
+					last = i
+				}
+			}
+		}
+		padCell := func(i int, s string, align Alignment, fill string) string {
+			if i == last {
+				return e.padLeading(s, widths[i], align, fill)
+			}
+			return e.pad(s, widths[i], align, fill)
+		}
+
+		// only wrapped cells leave other columns blank on some lines
+		wraps := false
+		for _, i := range page {
+			if spec, ok := specs[i]; ok && spec.Wrap {
+				wraps = true
+			}
+		}
+		for r, row := range output {
+			isHeader := rank[r] < 0
+
+			// render each cell as one or more lines
+			cells = cells[:0]
+			blanks = blanks[:0]
+			height := 1
+			for _, i := range page {
+				if widths[i] == 0 { // skip zero-width columns
+					continue
+				}
+				cell := row[i]
+				if spec, ok := specs[i]; ok && spec.Type == TypeBar && !isHeader {
+					target := spec.BarTarget
+					if target <= 0 {
+						target = barMax[i]
+					}
+					bar, over := e.renderBar(cell, target, widths[i])
+					if i == last {
+						bar = strings.TrimRight(bar, " ")
+					}
+					if wraps {
+						blanks = append(blanks, padCell(i, "", AlignLeft, " "))
+					}
+					if over && opts.Color {
+						bar = colors["red"] + bar + sgrReset
+					} else if spec.Color != "" && opts.Color {
+						bar = spec.Color + bar + sgrReset
+					}
+					cells = append(cells, []string{bar})
+					continue
+				}
+				align := AlignLeft
+				wrapped := false
+				truncation := TruncateAuto
+				fill := opts.FillChar
+				if spec, ok := specs[i]; ok {
+					align = spec.Align
+					wrapped = spec.Wrap
+					truncation = spec.Truncation
+					if spec.Fill != "" {
+						fill = spec.Fill
+					}
+				}
+				if fill == "" || isHeader {
+					fill = " "
+				}
+				c := len(cells)
+				pieces := lines[c : c+1 : c+1]
+				pieces[0] = cell
+				if e.displayWidth(cell) > widths[i] {
+					switch {
+					case wrapped:
+						pieces = e.wrap(cell, widths[i])
+					case truncation == TruncateMiddle:
+						pieces[0] = e.truncateMiddle(cell, widths[i], opts.Ellipsis)
+					case truncation == TruncatePath:
+						pieces[0] = e.truncatePath(cell, widths[i], align == AlignRight, opts.Ellipsis)
+					default:
+						// truncate column.  right-aligned columns keep
+						// their tail, since that's the end nearest the
+						// column's edge.  others keep their head.
+						keepTail := truncation == TruncateLeft || align == AlignRight
+						pieces[0] = e.truncate(cell, widths[i], keepTail, opts.Ellipsis)
+					}
+				}
+				// color after padding, so escape sequences don't
+				// affect alignment
+				color := ""
+				if spec, ok := specs[i]; ok && opts.Color && !isHeader {
+					if spec.Heat != nil {
+						color = heatColor(cell, spec.Heat)
+					}
+					if spec.EnumColors != nil {
+						color = spec.EnumColors[cell]
+					}
+					if color == "" {
+						color = spec.Color
+					}
+				}
+				for j, piece := range pieces {
+					pieces[j] = padCell(i, piece, align, fill)
+					if color != "" {
+						pieces[j] = color + pieces[j] + sgrReset
+					}
+				}
+				if wraps {
+					blank := padCell(i, "", align, fill)
+					if color != "" && blank != "" {
+						blank = color + blank + sgrReset
+					}
+					blanks = append(blanks, blank)
+				}
+				cells = append(cells, pieces)
+				if len(pieces) > height {
+					height = len(pieces)
+				}
+			}
+
+			// output lines, leaving columns blank once their cell
+			// runs out of lines
+			for k := 0; k < height; k++ {
+				columns = columns[:0] // empty the slice, reusing same memory
+				for c, pieces := range cells {
+					if k < len(pieces) {
+						columns = append(columns, pieces[k])
+					} else {
+						columns = append(columns, blanks[c])
+					}
+				}
+				line := strings.Join(columns, opts.FieldSeparator)
+				if opts.MarkOverflow {
+					line = e.clipLine(line, opts.TerminalWidth, overflowMarker)
+				} else if opts.Clip {
+					line = e.clipLine(line, opts.TerminalWidth, "")
+				}
+				if opts.Zebra && opts.Color && !isHeader && rank[r]%2 == 1 {
+					// cells' own colors end with a reset, which
+					// mustn't end the stripe
+					line = sgrStripe + strings.Replace(line, sgrReset, sgrReset+sgrStripe, -1) + sgrReset
+				}
+				out.WriteString(line)
+				if _, err := out.WriteString(opts.RecordSeparator); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if len(rows) == 0 && opts.EmptyMessage != "" {
+		out.WriteString(opts.EmptyMessage + opts.RecordSeparator)
+	}
+	return out.Flush()
+}
+
+// returns copies of rows and reference in which the values of
+// AlignDecimal columns are padded on the right, so that decimal points
+// line up when the values are right aligned.  values without a decimal
+// point align like whole numbers
+func (e *env) alignDecimals(rows, reference [][]string, specs map[int]*ColumnSpec) ([][]string, [][]string) {
+	var columns []int
+	for i, spec := range specs {
+		if spec.AlignDecimal {
+			columns = append(columns, i)
+		}
+	}
+	if len(columns) == 0 {
+		return rows, reference
+	}
+
+	// fraction returns the part of s from its decimal point onward
+	fraction := func(s string) string {
+		if i := strings.LastIndexByte(s, '.'); i >= 0 {
+			return s[i:]
+		}
+		return ""
+	}
+
+	// how wide is each column's widest fraction?
+	fractionWidths := make(map[int]int)
+	for _, table := range [][][]string{rows, reference} {
+		for _, row := range table {
+			for _, i := range columns {
+				if i >= len(row) {
+					continue
+				}
+				if width := e.displayWidth(fraction(row[i])); width > fractionWidths[i] {
+					fractionWidths[i] = width
+				}
+			}
+		}
+	}
+
+	// pad each value's fraction to that width
+	aligned := func(table [][]string) [][]string {
+		copied := make([][]string, len(table))
+		for r, row := range table {
+			row = append([]string(nil), row...)
+			for _, i := range columns {
+				if i < len(row) {
+					padding := fractionWidths[i] - e.displayWidth(fraction(row[i]))
+					row[i] += strings.Repeat(" ", padding)
+				}
+			}
+			copied[r] = row
+		}
+		return copied
+	}
+	return aligned(rows), aligned(reference)
+}
+
+// chooses the width of each column to fit the cells of headerRows,
+// rows and opts.Reference within the limits of specs
+func (e *env) columnWidths(headerRows, rows [][]string, specs map[int]*ColumnSpec, opts Options) ([]int, error) {
+	specs = resolvePercentWidths(specs, opts.TerminalWidth)
+
+	// calculate column widths
+	var first []string
+	if len(headerRows) > 0 {
+		first = headerRows[0]
+	} else {
+		first = rows[0]
+	}
+	widths := make([]int, len(first))
+	for _, rows := range [][][]string{headerRows, rows, opts.Reference} {
+		if err := e.measureWidths(widths, rows); err != nil {
+			return nil, err
+		}
+	}
+
+	// adjust column widths based on specs
+	for i, width := range widths {
+		spec, ok := specs[i]
+		if !ok {
+			continue
+		}
+
+		if width < spec.WidthMin {
+			widths[i] = spec.WidthMin
+		}
+		if spec.WidthMax >= 0 && width > spec.WidthMax {
+			widths[i] = spec.WidthMax
+		}
+		if spec.Type == TypeBar && spec.WidthMin == 0 {
+			// bar length is unrelated to the values' text
+			widths[i] = defaultBarWidth
+		}
+		if spec.Hidden {
+			widths[i] = 0
+		}
+	}
+
+	// keep headers readable, even when that exceeds WidthMax
+	specs = copySpecs(specs)
+	for _, header := range headerRows {
+		for i, name := range header {
+			if spec, ok := specs[i]; ok && spec.Hidden {
+				continue
+			}
+			width := e.displayWidth(name)
+			if width > widths[i] {
+				widths[i] = width
+			}
+			if spec, ok := specs[i]; ok && width > spec.WidthMin {
+				// specs may be shared between columns, so widen a copy
+				widened := *spec
+				widened.WidthMin = width
+				if widened.WidthMax >= 0 && widened.WidthMax < width {
+					widened.WidthMax = width
+				}
+				specs[i] = &widened
+			}
+		}
+	}
+	e.debug("widths = %v", widths)
+	if opts.Rebalance {
+		gutter := e.displayWidth(opts.FieldSeparator)
+		if opts.Proportional {
+			widths = rebalanceProportionally(widths, specs, opts.TerminalWidth, gutter)
+		} else {
+			widths = e.rebalanceWidths(widths, specs, opts.TerminalWidth, gutter)
+		}
+		e.debug("rebalanced = %v", widths)
+	}
+	if opts.Fill && opts.TerminalWidth > 0 {
+		gutter := e.displayWidth(opts.FieldSeparator)
+		widths = e.growWidths(widths, specs, opts.TerminalWidth, gutter)
+		e.debug("grown = %v", widths)
+	}
+	return widths, nil
+
+}
+
+// returns the widths of n columns whose specs each fix their width,
+// as needed for formatting rows before they've all been seen
+func fixedWidths(n int, specs map[int]*ColumnSpec) ([]int, error) {
+	widths := make([]int, n)
+	for i := range widths {
+		spec, ok := specs[i]
+		if ok && spec.Hidden {
+			continue
+		}
+		if !ok || spec.WidthMin != spec.WidthMax {
+			return nil, fmt.Errorf("column %d needs a fixed width like 8c", i+1)
+		}
+		widths[i] = spec.WidthMax
+	}
+	return widths, nil
+}
+
+// returns specs for a table with this many columns.  negative keys,
+// which count from the last column, become 0-based indices.  the
+// DefaultColumn spec, if any, goes to each column without its own
+// spec.  columns given by number take precedence over those counted
+// from the end.  a negative key beyond the first column is an error,
+// but the other specs are still resolved
+func resolveSpecs(specs map[int]*ColumnSpec, columns int) (map[int]*ColumnSpec, error) {
+	relative := false
+	for i := range specs {
+		if i < 0 {
+			relative = true
+		}
+	}
+	if !relative {
+		return specs, nil
+	}
+
+	var err error
+	resolved := make(map[int]*ColumnSpec, columns)
+	for i, spec := range specs {
+		if i >= 0 {
+			resolved[i] = spec
+		}
+	}
+	for i, spec := range specs {
+		if i >= 0 || i == DefaultColumn {
+			continue
+		}
+		if columns+i < 0 {
+			err = fmt.Errorf("column %d is out of range; records have %d fields", i, columns)
+			continue
+		}
+		if _, ok := resolved[columns+i]; !ok {
+			resolved[columns+i] = spec
+		}
+	}
+	if fallback, ok := specs[DefaultColumn]; ok {
+		for i := 0; i < columns; i++ {
+			if _, ok := resolved[i]; !ok {
+				resolved[i] = fallback
+			}
+		}
+	}
+	return resolved, err
+}
+
+// returns specs with each WidthPercent converted into a fixed width,
+// given the terminal's width.  when that's unknown (0), percentage
+// widths are left unresolved, so those columns fit their cells
+func resolvePercentWidths(specs map[int]*ColumnSpec, terminalWidth int) map[int]*ColumnSpec {
+	if terminalWidth <= 0 {
+		return specs
+	}
+	resolved := copySpecs(specs)
+	for i, spec := range specs {
+		if spec.WidthPercent > 0 {
+			fixed := *spec
+			fixed.WidthMin = terminalWidth * spec.WidthPercent / 100
+			fixed.WidthMax = fixed.WidthMin
+			resolved[i] = &fixed
+		}
+	}
+	return resolved
+}
+
+// returns a shallow copy of specs, so entries can be replaced without
+// affecting the caller
+func copySpecs(specs map[int]*ColumnSpec) map[int]*ColumnSpec {
+	copied := make(map[int]*ColumnSpec, len(specs))
+	for i, spec := range specs {
+		copied[i] = spec
+	}
+	return copied
+}
+
+// groups column indices into pages which each fit within the
+// terminal's width.  if key is a valid column index, that column
+// starts every page.  each page holds at least one column besides the
+// key, even if that's too wide for the terminal.
+func paginateColumns(widths []int, key int, availableWidth int, gutter int) [][]int {
+	hasKey := key >= 0 && key < len(widths)
+	keys := 0
+	if hasKey {
+		keys = 1
+	}
+	var pages [][]int
+	var page []int
+	consumedWidth := 0
+	for i, width := range widths {
+		if i == key || width == 0 {
+			continue
+		}
+
+		// start a new page when this column doesn't fit on the current one
+		crowded := availableWidth > 0 && consumedWidth+gutter+width > availableWidth
+		if page == nil || (crowded && len(page) > keys) {
+			if page != nil {
+				pages = append(pages, page)
+			}
+			page = []int{}
+			consumedWidth = -gutter
+			if hasKey {
+				page = append(page, key)
+				consumedWidth += gutter + widths[key]
+			}
+		}
+		page = append(page, i)
+		consumedWidth += gutter + width
+	}
+	if page != nil {
+		pages = append(pages, page)
+	}
+	return pages
+}
+
+// separates a spec block at the start of r from the data which
+// follows it.  the block ends with a line containing only
+// specBlockSentinel.  if there's no such line, all of r is data and
+// the spec is empty.
+func readSpecBlock(r io.Reader) (string, io.Reader, error) {
+	buffered := bufio.NewReader(r)
+	var consumed bytes.Buffer
+	for {
+		line, err := buffered.ReadString('\n')
+		if strings.TrimRight(line, "\r\n") == specBlockSentinel {
+			return consumed.String(), buffered, nil
+		}
+		consumed.WriteString(line)
+		if err == io.EOF {
+			return "", &consumed, nil
+		}
+		if err != nil {
+			return "", nil, err
+		}
+	}
+}
+
+// how many records -auto examines when choosing a field separator
+const autoSampleRecords = 10
+
+// field separators which -auto chooses among, preferred in this order
+var autoSeparators = []byte{'\t', ',', '|'}
+
+// chooses the field separator which splits the first records of r into
+// the same number of fields.  when none or several do, it chooses tab.
+// the returned reader yields all of r, including the examined records
+func detectSeparator(r io.Reader, recordSeparator byte) (byte, io.Reader, error) {
+	buffered := bufio.NewReader(r)
+	var consumed bytes.Buffer
+	var records [][]byte
+	for len(records) < autoSampleRecords {
+		line, err := buffered.ReadBytes(recordSeparator)
+		consumed.Write(line)
+		line = bytes.TrimSuffix(line, []byte{recordSeparator})
+		if recordSeparator == '\n' {
+			line = bytes.TrimSuffix(line, []byte{'\r'})
+		}
+		if len(line) > 0 {
+			records = append(records, line)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+	}
+	restored := io.MultiReader(&consumed, buffered)
+
+	var candidates []byte
+	for _, separator := range autoSeparators {
+		if splitsEvenly(records, separator) {
+			candidates = append(candidates, separator)
+		}
+	}
+	if len(candidates) != 1 {
+		return '\t', restored, nil
+	}
+	return candidates[0], restored, nil
+}
+
+// reports whether separator appears in every record, the same number
+// of times
+func splitsEvenly(records [][]byte, separator byte) bool {
+	if len(records) == 0 {
+		return false
+	}
+	n := bytes.Count(records[0], []byte{separator})
+	if n == 0 {
+		return false
+	}
+	for _, record := range records[1:] {
+		if bytes.Count(record, []byte{separator}) != n {
+			return false
+		}
+	}
+	return true
+}
+
+// splits a record into fields
+type fieldSplitter func(record string) []string
+
+// splits records on each separator.  maxFields limits how many fields
+// a record is split into; -1 means no limit
+func splitOn(separator string, maxFields int) fieldSplitter {
+	return func(record string) []string {
+		return strings.SplitN(record, separator, maxFields)
+	}
+}
+
+// splits records on each match of re, like awk's FS.  separators at
+// the start or end of a record don't make empty fields, and matches of
+// no text separate nothing.  maxFields limits how many fields a record
+// is split into; -1 means no limit
+func splitRegexp(re *regexp.Regexp, maxFields int) fieldSplitter {
+	return func(record string) []string {
+		var fields []string
+		start := 0
+		for _, loc := range re.FindAllStringIndex(record, -1) {
+			if loc[0] == loc[1] {
+				continue
+			}
+			if loc[0] == 0 {
+				start = loc[1]
+				continue
+			}
+			if maxFields > 0 && len(fields) == maxFields-1 {
+				break
+			}
+			if loc[1] == len(record) {
+				record = record[:loc[0]]
+				break
+			}
+			fields = append(fields, record[start:loc[0]])
+			start = loc[1]
+		}
+		return append(fields, record[start:])
+	}
+}
+
+// splits records into fields at fixed character positions.  each
+// position is a range of 0-based character offsets, including the
+// first but not the last; a last of -1 extends to the end of the
+// record.  fields beyond the end of a record are empty
+func splitAt(positions [][2]int) fieldSplitter {
+	return func(record string) []string {
+		// byte offset of each character, then of the record's end
+		offsets := make([]int, 0, len(record)+1)
+		for i := range record {
+			offsets = append(offsets, i)
+		}
+		offsets = append(offsets, len(record))
+		offset := func(n int) int {
+			if n < 0 || n >= len(offsets) {
+				return len(record)
+			}
+			return offsets[n]
+		}
+
+		fields := make([]string, len(positions))
+		for i, position := range positions {
+			fields[i] = record[offset(position[0]):offset(position[1])]
+		}
+		return fields
+	}
+}
+
+// parses a list of character ranges like 0-10,10-25,25- where each
+// range includes its first offset but not its last, and a range
+// without a last offset extends to the end of the record
+func parsePositions(description string) ([][2]int, error) {
+	var positions [][2]int
+	for _, word := range strings.Split(description, ",") {
+		bounds := strings.Split(word, "-")
+		if len(bounds) != 2 {
+			return nil, fmt.Errorf("invalid position range: %s", word)
+		}
+		first, err := strconv.Atoi(bounds[0])
+		if err != nil || first < 0 {
+			return nil, fmt.Errorf("invalid position: %s", bounds[0])
+		}
+		last := -1
+		if bounds[1] != "" {
+			last, err = strconv.Atoi(bounds[1])
+			if err != nil || last <= first {
+				return nil, fmt.Errorf("invalid position: %s", bounds[1])
+			}
+		}
+		positions = append(positions, [2]int{first, last})
+	}
+	return positions, nil
+}
+
+// reads records from r, splitting each into fields, and calls fn with
+// each row as soon as it's read
+func scanRows(r io.Reader, recordSeparator byte, split fieldSplitter, fn func([]string) error) error {
+	s := bufio.NewScanner(r)
+	s.Split(on(recordSeparator))
+	for s.Scan() {
+		line := s.Bytes()
+		if recordSeparator == '\n' {
+			line = bytes.TrimSuffix(line, []byte{'\r'}) // CRLF line ending
+		}
+		if recordSeparator == 0 && len(line) == 0 {
+			continue // empty record between consecutive NULs
+		}
+		// copy the record once, since scanner reuses byte array.
+		// fields share the copy
+		if err := fn(split(string(line))); err != nil {
+			return err
+		}
+	}
+	return s.Err()
+}
+
+// reads CSV records from r, as described in RFC 4180, and calls fn
+// with each row as soon as it's read.  records may have differing
+// numbers of fields
+func scanCSVRows(r io.Reader, fn func([]string) error) error {
+	c := csv.NewReader(r)
+	c.FieldsPerRecord = -1
+	for {
+		row, err := c.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+}
+
+// writes each table's rows to w as CSV records, as described in RFC
+// 4180
+func writeCSVRows(w io.Writer, specs map[int]*ColumnSpec, tables ...[][]string) error {
+	c := csv.NewWriter(w)
+	for _, rows := range tables {
+		for _, row := range rows {
+			if err := c.Write(visibleCells(row, specs)); err != nil {
+				return err
+			}
+		}
+	}
+	c.Flush()
+	return c.Error()
+}
+
+// writes rows to w as a Markdown table.  if header is nil, columns are
+// named c1, c2, etc.  each column's alignment comes from its spec
+func writeMarkdown(w io.Writer, header []string, rows [][]string, specs map[int]*ColumnSpec) error {
+	if header == nil {
+		n := 0
+		for _, row := range rows {
+			if len(row) > n {
+				n = len(row)
+			}
+		}
+		for i := 1; i <= n; i++ {
+			header = append(header, "c"+strconv.Itoa(i))
+		}
+	}
+
+	rules := make([]string, len(header))
+	for i := range rules {
+		rules[i] = "---"
+		spec, ok := specs[i]
+		if !ok {
+			continue
+		}
+		// markdown already aligns left, so only an explicit left
+		// gets a hint
+		switch spec.Align {
+		case AlignLeft:
+			if spec.explicitAlign {
+				rules[i] = ":---"
+			}
+		case AlignRight:
+			rules[i] = "---:"
+		case AlignCenter:
+			rules[i] = ":---:"
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	writeRow := func(row []string) {
+		bw.WriteString("|")
+		for _, cell := range visibleCells(row, specs) {
+			cell = strings.Replace(cell, "|", "\\|", -1)
+			bw.WriteString(" " + cell + " |")
+		}
+		bw.WriteString("\n")
+	}
+	writeRow(header)
+	bw.WriteString("|")
+	for _, rule := range visibleCells(rules, specs) {
+		bw.WriteString(" " + rule + " |")
+	}
+	bw.WriteString("\n")
+	for _, row := range rows {
+		writeRow(row)
+	}
+	return bw.Flush()
+}
+
+// returns the cells of row whose columns aren't hidden by specs
+func visibleCells(row []string, specs map[int]*ColumnSpec) []string {
+	visible := make([]string, 0, len(row))
+	for i, cell := range row {
+		if spec, ok := specs[i]; ok && spec.Hidden {
+			continue
+		}
+		visible = append(visible, cell)
+	}
+	return visible
+}
+
+// sorts rows by column, descending if reverse is true.  if key is not
+// nil, cells are compared by the value it parses from them.  cells it
+// can't parse go last, in order of their text.  rows which compare
+// equal keep their order
+func sortRows(rows [][]string, column int, reverse bool, key func(string) (float64, error)) error {
+	for _, row := range rows {
+		if column >= len(row) {
+			return fmt.Errorf("sort column %d doesn't exist", column+1)
+		}
+	}
+
+	// parse each cell once
+	type sortable struct {
+		row    []string
+		value  float64
+		parsed bool
+	}
+	items := make([]sortable, len(rows))
+	for i, row := range rows {
+		items[i].row = row
+		if key != nil {
+			value, err := key(row[column])
+			items[i].value, items[i].parsed = value, err == nil
+		}
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		a, b := items[i], items[j]
+		if a.parsed != b.parsed {
+			return a.parsed
+		}
+		if a.parsed && a.value != b.value {
+			return (a.value < b.value) != reverse
+		}
+		x, y := a.row[column], b.row[column]
+		if reverse {
+			return x > y
+		}
+		return x < y
+	})
+	for i := range items {
+		rows[i] = items[i].row
+	}
+	return nil
+}
+
+// chooses how to parse cells for sorting a column with spec.  returns
+// nil to compare their text
+func (e *env) sortKey(spec *ColumnSpec, numeric bool) func(string) (float64, error) {
+	if spec != nil {
+		switch spec.Type {
+		case TypeAge, TypeDate:
+			return func(s string) (float64, error) {
+				t, err := e.parseTime(s)
+				return float64(t.UnixNano()), err
+			}
+		case TypeDuration:
+			return func(s string) (float64, error) {
+				d, err := parseDuration(s)
+				return float64(d), err
+			}
+		case TypeNumber, TypePercent:
+			return parseNumber
+		}
+		if spec.Scale != 0 {
+			return parseNumber
+		}
+	}
+	if numeric {
+		return parseNumber
+	}
+	return nil
+}
+
+// appends empty fields to short rows so that every row in every
+// table has as many fields as the widest row
+func padRows(tables ...[][]string) {
+	fields := 0
+	for _, rows := range tables {
+		for _, row := range rows {
+			if len(row) > fields {
+				fields = len(row)
+			}
+		}
+	}
+	for _, rows := range tables {
+		for i, row := range rows {
+			for len(row) < fields {
+				row = append(row, "")
+			}
+			rows[i] = row
+		}
+	}
+}
+
+// swaps the rows and columns of rows.  short rows are padded with
+// empty fields, so every column has a cell for each row
+func transposeRows(rows [][]string) [][]string {
+	fields := 0
+	for _, row := range rows {
+		if len(row) > fields {
+			fields = len(row)
+		}
+	}
+	transposed := make([][]string, fields)
+	for i := range transposed {
+		transposed[i] = make([]string, len(rows))
+		for j, row := range rows {
+			if i < len(row) {
+				transposed[i][j] = row[i]
+			}
+		}
+	}
+	return transposed
+}
+
+// parses a merge description like 2-4 or 2-4:/ where the optional text
+// after : joins the merged values (default is a space).  returns
+// 0-based column indices
+func parseMerge(description string) (int, int, string, error) {
+	joiner := " "
+	if i := strings.Index(description, ":"); i >= 0 {
+		joiner = description[i+1:]
+		description = description[0:i]
+	}
+
+	bounds := strings.Split(description, "-")
+	if len(bounds) != 2 {
+		return 0, 0, "", fmt.Errorf("invalid column range: %s", description)
+	}
+	first, err := strconv.Atoi(bounds[0])
+	if err != nil || first < 1 {
+		return 0, 0, "", fmt.Errorf("invalid column number: %s", bounds[0])
+	}
+	last, err := strconv.Atoi(bounds[1])
+	if err != nil || last < first {
+		return 0, 0, "", fmt.Errorf("invalid column number: %s", bounds[1])
+	}
+	return first - 1, last - 1, joiner, nil
+}
+
+// replaces columns first through last (inclusive) of each row with a
+// single column holding their values joined together.  the merged
+// column takes the place of column first, so specs for later columns
+// refer to their position after merging.  empty values are skipped,
+// so they don't leave doubled joiners.
+func mergeColumns(rows [][]string, first, last int, joiner string) error {
+	for i, row := range rows {
+		if last >= len(row) {
+			return fmt.Errorf("merged column %d doesn't exist", last+1)
+		}
+		var values []string
+		for _, value := range row[first : last+1] {
+			if value != "" {
+				values = append(values, value)
+			}
+		}
+		merged := strings.Join(values, joiner)
+		row = append(row[0:first+1], row[last+1:]...)
+		row[first] = merged
+		rows[i] = row
+	}
+	return nil
+}
+
+// inserts a column before the others in each row, holding the text
+// which label returns for the row's index
+func prependColumn(rows [][]string, label func(int) string) {
+	for i, row := range rows {
+		rows[i] = append([]string{label(i)}, row...)
+	}
+}
+
+// returns specs keyed by column index plus n
+func shiftSpecs(specs map[int]*ColumnSpec, n int) map[int]*ColumnSpec {
+	shifted := make(map[int]*ColumnSpec, len(specs)+n)
+	for i, spec := range specs {
+		shifted[i+n] = spec
+	}
+	return shifted
+}
+
+// parses a list of 1-based column numbers like 3,1.  returns 0-based
+// column indices
+func parseColumnList(description string) ([]int, error) {
+	var columns []int
+	for _, word := range strings.Split(description, ",") {
+		n, err := strconv.Atoi(word)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid column number: %s", word)
+		}
+		columns = append(columns, n-1)
+	}
+	return columns, nil
+}
+
+// replaces each row with the columns listed in projection, in that
+// order
+func projectColumns(rows [][]string, projection []int) error {
+	for i, row := range rows {
+		projected := make([]string, len(projection))
+		for j, column := range projection {
+			if column >= len(row) {
+				return fmt.Errorf("column %d doesn't exist; records have %d fields", column+1, len(row))
+			}
+			projected[j] = row[column]
+		}
+		rows[i] = projected
+	}
+	return nil
+}
+
+// returns specs keyed by output column, for columns chosen by
+// projection
+func projectSpecs(specs map[int]*ColumnSpec, projection []int) map[int]*ColumnSpec {
+	projected := make(map[int]*ColumnSpec)
+	for j, column := range projection {
+		if spec, ok := specs[column]; ok {
+			projected[j] = spec
+		}
+	}
+	return projected
+}
+
+// converts a 1-based input column number into its 1-based position
+// after projection, or 0 if projection omits it
+func projectedColumn(n int, projection []int) int {
+	if projection == nil {
+		return n
+	}
+	for j, column := range projection {
+		if column == n-1 {
+			return j + 1
+		}
+	}
+	return 0
+}
+
+// tabPolicy describes what to do with tabs found inside a field
+type tabPolicy struct {
+	// Mode is one of: error, keep, replace or expand
+	Mode string
+
+	// Width is the number of spaces which replace each tab, or the
+	// distance between tab stops when expanding.
+	Width int
+}
+
+// parses a tab policy like: error, keep, replace:4 or expand:8.  the
+// width defaults to 1 for replace and 8 for expand
+func parseTabPolicy(description string) (tabPolicy, error) {
+	parts := strings.SplitN(description, ":", 2)
+	policy := tabPolicy{Mode: parts[0]}
+	switch policy.Mode {
+	case "error", "keep":
+		if len(parts) > 1 {
+			return policy, fmt.Errorf("unexpected width: %s", description)
+		}
+		return policy, nil
+	case "replace":
+		policy.Width = 1
+	case "expand":
+		policy.Width = 8
+	default:
+		return policy, fmt.Errorf("unknown mode: %s", policy.Mode)
+	}
+
+	if len(parts) > 1 {
+		width, err := strconv.Atoi(parts[1])
+		if err != nil || width < 0 || (width == 0 && policy.Mode == "expand") {
+			return policy, fmt.Errorf("invalid width: %s", parts[1])
+		}
+		policy.Width = width
+	}
+	return policy, nil
+}
+
+// applies the policy to every cell in rows
+func (p tabPolicy) applyRows(rows [][]string) error {
+	if p.Mode == "keep" {
+		return nil
+	}
+	for i, row := range rows {
+		for j, cell := range row {
+			if !strings.Contains(cell, "\t") {
+				continue
+			}
+			switch p.Mode {
+			case "error":
+				return fmt.Errorf("record %d, field %d contains a tab", i+1, j+1)
+			case "replace":
+				row[j] = strings.Replace(cell, "\t", strings.Repeat(" ", p.Width), -1)
+			case "expand":
+				row[j] = expandTabs(cell, p.Width)
+			}
+		}
+	}
+	return nil
+}
+
+// replaces each tab with enough spaces to reach the next tab stop,
+// counting columns from the start of the cell
+func expandTabs(s string, tabStop int) string {
+	var expanded strings.Builder
+	column := 0
+	for _, r := range s {
+		if r == '\t' {
+			n := tabStop - column%tabStop
+			expanded.WriteString(strings.Repeat(" ", n))
+			column += n
+			continue
+		}
+		expanded.WriteRune(r)
+		column += runeWidth(r)
+	}
+	return expanded.String()
+}
+
+// RenderRows replaces each cell with its rendering according to its
+// column's spec, such as converting timestamps in age columns into
+// ages.  Cells which can't be rendered are left unchanged, with a
+// warning.
+func RenderRows(rows [][]string, specs map[int]*ColumnSpec, opts Options) {
+	opts.env().renderRows(rows, specs)
+}
+
+// like RenderRows, with settings from e
+func (e *env) renderRows(rows [][]string, specs map[int]*ColumnSpec) {
+	if len(rows) > 0 {
+		// Format reports columns which are out of range
+		specs, _ = resolveSpecs(specs, len(rows[0]))
+	}
+	for _, row := range rows {
+		for i, cell := range row {
+			if spec, ok := specs[i]; ok {
+				row[i] = e.renderCell(cell, spec)
+			}
+		}
+	}
+}
+
+// renders a single cell according to its column's type.  cells which
+// can't be rendered are returned unchanged, with a warning
+func (e *env) renderCell(s string, spec *ColumnSpec) string {
+	var err error
+	if spec.Scale != 0 {
+		original := s
+		s, err = renderScaled(original, spec.Scale, spec.Decimals)
+		if err != nil {
+			e.warn("Unexpected number format: %q", original)
+			return s
+		}
+	}
+
+	original := s
+	switch spec.Type {
+	case TypeAge:
+		s, err = e.renderAge(original, e.ageScale)
+		if err != nil {
+			e.warn("Unexpected date format: %q", original)
+		}
+	case TypeEnum:
+		s = e.renderEnum(original, spec.Enum)
+	case TypeGroup:
+		s, err = renderGroup(original, spec.Group, spec.GroupSeparator)
+		if err != nil {
+			e.warn("Unexpected length for grouping: %q", original)
+		}
+	case TypeIP:
+		s, err = renderIP(original, spec.ZeroPad)
+		if err != nil {
+			e.warn("Unexpected IP address format: %q", original)
+		}
+	case TypeNumber:
+		s, err = renderNumber(original, spec.Decimals)
+		if err != nil {
+			e.warn("Unexpected number format: %q", original)
+		}
+	case TypeDate:
+		s, err = e.renderDate(original, spec.DateLayout)
+		if err != nil {
+			e.warn("Unexpected date format: %q", original)
+		}
+	case TypeOrdinal:
+		s, err = renderOrdinal(original)
+		if err != nil {
+			e.warn("Unexpected integer format: %q", original)
+		}
+	case TypePercent:
+		s, err = renderPercent(original, spec.PercentPoints, spec.Decimals)
+		if err != nil {
+			e.warn("Unexpected number format: %q", original)
+		}
+	case TypeBool:
+		s, err = renderBool(original, e.boolGlyphs)
+		if err != nil {
+			e.warn("Unexpected boolean format: %q", original)
+		}
+	case TypeDuration:
+		if spec.Clock {
+			s, err = renderClock(original)
+		} else {
+			s, err = renderDuration(original)
+		}
+		if err != nil {
+			e.warn("Unexpected duration format: %q", original)
+		}
+	}
+	return changeCase(s, spec.Case)
+}
+
+// changes the case of s to upper, lower or title case, according to
+// letterCase.  "" leaves s alone
+func changeCase(s, letterCase string) string {
+	switch letterCase {
+	case "upper":
+		return strings.ToUpper(s)
+	case "lower":
+		return strings.ToLower(s)
+	case "title":
+		return cases.Title(language.Und).String(s)
+	}
+	return s
+}
+
+// wraps ambiguous cells in double quotes: those containing either
+// separator or a double quote, and those with leading or trailing
+// whitespace.  embedded double quotes are doubled.
+func quoteRows(rows [][]string, fieldSeparator, recordSeparator string) {
+	for _, row := range rows {
+		for i, cell := range row {
+			ambiguous := strings.Contains(cell, fieldSeparator) ||
+				strings.Contains(cell, recordSeparator) ||
+				strings.Contains(cell, `"`) ||
+				strings.TrimSpace(cell) != cell
+			if ambiguous {
+				row[i] = `"` + strings.Replace(cell, `"`, `""`, -1) + `"`
+			}
+		}
+	}
+}
+
+// escapes or strips control characters in every cell, according to
+// mode (keep, escape or strip).  tabs are left alone, as are escape
+// sequences when they're recognized (see ansiAware)
+func (e *env) cleanControls(rows [][]string, mode string) {
+	if mode == "keep" {
+		return
+	}
+	for _, row := range rows {
+		for i, cell := range row {
+			if strings.IndexFunc(cell, isControl) < 0 {
+				continue
+			}
+			var b strings.Builder
+			for j := 0; j < len(cell); {
+				if n := e.escapeLength(cell[j:]); n > 0 {
+					b.WriteString(cell[j : j+n])
+					j += n
+					continue
+				}
+				r, size := utf8.DecodeRuneInString(cell[j:])
+				j += size
+				if !isControl(r) {
+					b.WriteRune(r)
+					continue
+				}
+				if mode == "escape" {
+					b.WriteString(escapeControl(r))
+				}
+			}
+			row[i] = b.String()
+		}
+	}
+}
+
+// reports whether r is a control character other than tab
+func isControl(r rune) bool {
+	return r != '\t' && unicode.IsControl(r)
+}
+
+// shows a control character in caret notation like ^M, or as \u0085
+// for those without one
+func escapeControl(r rune) string {
+	switch {
+	case r < 0x20:
+		return "^" + string(r+'@')
+	case r == 0x7f:
+		return "^?"
+	}
+	return fmt.Sprintf("\\u%04x", r)
+}
+
+// removes whitespace surrounding cells in columns whose spec asks for
+// it, or in every column if all is true
+func trimCells(rows [][]string, specs map[int]*ColumnSpec, all bool) {
+	for _, row := range rows {
+		for i, cell := range row {
+			if spec, ok := specs[i]; all || ok && spec.Trim {
+				row[i] = strings.TrimSpace(cell)
+			}
+		}
+	}
+}
+
+// replaces cells which are empty or only whitespace with placeholder,
+// or with their spec's Empty text if it has one.  an empty placeholder
+// leaves cells unchanged
+func fillEmptyCells(rows [][]string, specs map[int]*ColumnSpec, placeholder string) {
+	for _, row := range rows {
+		for i, cell := range row {
+			if strings.TrimSpace(cell) != "" {
+				continue
+			}
+			if spec, ok := specs[i]; ok && spec.Empty != "" {
+				row[i] = spec.Empty
+			} else if placeholder != "" {
+				row[i] = placeholder
+			}
+		}
+	}
+}
+
+// replaces values in delta columns with their difference from the
+// value in the previous row.  the first row, having no predecessor, is
+// blank.  differences have as many decimal places as the most precise
+// value, unless the spec chooses otherwise.  num columns group their
+// differences into thousands.
+func (e *env) renderDeltas(rows [][]string, specs map[int]*ColumnSpec) {
+	for col, spec := range specs {
+		if !spec.Delta {
+			continue
+		}
+
+		decimals := spec.Decimals
+		if decimals < 0 {
+			decimals = 0
+			for _, row := range rows {
+				if col >= len(row) {
+					continue
+				}
+				if i := strings.IndexByte(row[col], '.'); i >= 0 && len(row[col])-i-1 > decimals {
+					decimals = len(row[col]) - i - 1
+				}
+			}
+		}
+
+		var previous float64
+		hasPrevious := false
+		for _, row := range rows {
+			if col >= len(row) {
+				continue
+			}
+			n, err := parseNumber(row[col])
+			if err != nil {
+				e.warn("Unexpected number format: %q", row[col])
+				row[col] = ""
+				continue
+			}
+			if hasPrevious {
+				delta := n - previous
+				row[col] = strconv.FormatFloat(delta, 'f', decimals, 64)
+				if spec.Type == TypeNumber {
+					row[col], _ = renderNumber(row[col], -1)
+				}
+				if delta >= 0 {
+					row[col] = "+" + row[col]
+				}
+			} else {
+				row[col] = ""
+			}
+			previous = n
+			hasPrevious = true
+		}
+	}
+}
+
+// appends a column to each row holding the cumulative sum of column
+// src through that row.  totals have as many decimal places as the
+// most precise value being summed, and are grouped like the values
+// when spec, which may be nil, is a num column
+func (e *env) appendRunningTotal(rows [][]string, src int, spec *ColumnSpec) error {
+	precision := 0
+	for _, row := range rows {
+		if src >= len(row) {
+			return fmt.Errorf("running total column %d doesn't exist", src+1)
+		}
+		if i := strings.IndexByte(row[src], '.'); i >= 0 {
+			if digits := len(row[src]) - i - 1; digits > precision {
+				precision = digits
+			}
+		}
+	}
+
+	total := 0.0
+	for i, row := range rows {
+		if n, err := parseNumber(row[src]); err == nil {
+			total += n
+		} else {
+			e.warn("Unexpected number format: %q", row[src])
+		}
+		cell := strconv.FormatFloat(total, 'f', precision, 64)
+		if spec != nil && spec.Type == TypeNumber {
+			cell, _ = renderNumber(cell, -1)
+		}
+		rows[i] = append(row, cell)
+	}
+	return nil
+}
+
+// reports whether any spec chooses how to total its column
+func hasTotals(specs map[int]*ColumnSpec) bool {
+	for _, spec := range specs {
+		if spec.Total != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// returns a row summarizing each of the columns of rows, aggregated as
+// chosen by their specs (see ColumnSpec.Total).  cells are blank when
+// there's nothing to aggregate.  the first cell, if blank, is labeled
+// "total"
+func (e *env) summarizeRows(rows [][]string, specs map[int]*ColumnSpec, columns int) []string {
+	summary := make([]string, columns)
+	for i := range summary {
+		spec, ok := specs[i]
+		if !ok {
+			continue
+		}
+		fn := spec.Total
+		if fn == "" && (spec.Type == TypeNumber || spec.Scale != 0) {
+			fn = "sum"
+		}
+		if fn == "" {
+			continue
+		}
+
+		var cells []string
+		for _, row := range rows {
+			if i < len(row) && strings.TrimSpace(row[i]) != "" {
+				cells = append(cells, row[i])
+			}
+		}
+		summary[i] = e.aggregate(cells, fn, spec)
+	}
+	if columns > 0 && summary[0] == "" {
+		summary[0] = "total"
+	}
+	return summary
+}
+
+// aggregates cells with fn: sum, avg, min, max or count.  cells are
+// parsed according to spec's type, like when sorting.  sums have as
+// many decimal places as the most precise value; averages have two
+// more.  returns "" if no cells could be parsed, or if the type can't
+// be summed
+func (e *env) aggregate(cells []string, fn string, spec *ColumnSpec) string {
+	if fn == "count" {
+		return strconv.Itoa(len(cells))
+	}
+
+	key := e.sortKey(spec, true)
+	best, bestValue := "", 0.0
+	total, n, precision := 0.0, 0, 0
+	for _, cell := range cells {
+		value, err := key(cell)
+		if err != nil {
+			continue // rendering the cell warns about it
+		}
+		if i := strings.IndexByte(cell, '.'); i >= 0 {
+			if digits := len(cell) - i - 1; digits > precision {
+				precision = digits
+			}
+		}
+		if n == 0 || (fn == "min" && value < bestValue) || (fn == "max" && value > bestValue) {
+			best, bestValue = cell, value
+		}
+		total += value
+		n++
+	}
+	if n == 0 {
+		return ""
+	}
+
+	switch fn {
+	case "min", "max":
+		return best
+	}
+	if spec.Type == TypeAge || spec.Type == TypeDate {
+		return "" // instants can't be added together
+	}
+	if fn == "avg" {
+		total /= float64(n)
+		precision += 2
+	}
+	if spec.Type == TypeDuration {
+		return strconv.FormatFloat(total/float64(time.Second), 'f', -1, 64)
+	}
+	return strconv.FormatFloat(total, 'f', precision, 64)
+}
+
+// widens each column, as necessary, to hold every cell of rows
+func (e *env) measureWidths(widths []int, rows [][]string) error {
+	for _, row := range rows {
+		if len(row) != len(widths) {
+			return errors.New("Not all records have the same number of fields (try -p)")
+		}
+		for j, column := range row {
+			if width := e.displayWidth(column); width > widths[j] {
+				widths[j] = width
+			}
+		}
+	}
+	return nil
+}
+
+// shortens s to fit within width columns, marking the cut with
+// indicator.  if keepTail is true, the end of s is kept and the
+// indicator goes first.  when width is too narrow for the indicator,
+// s is cut without one.
+func (e *env) truncate(s string, width int, keepTail bool, indicator string) string {
+	if e.displayWidth(s) <= width {
+		return s
+	}
+	if e.displayWidth(indicator) >= width {
+		indicator = ""
+	}
+
+	keep := width - e.displayWidth(indicator)
+	if keepTail {
+		return indicator + e.tail(s, keep)
+	}
+	return e.head(s, keep) + indicator
+}
+
+// like truncate, but keeps both ends of s, placing indicator where the
+// middle was cut.  any odd column goes to the head
+func (e *env) truncateMiddle(s string, width int, indicator string) string {
+	if e.displayWidth(s) <= width {
+		return s
+	}
+	if e.displayWidth(indicator) >= width {
+		indicator = ""
+	}
+
+	keep := width - e.displayWidth(indicator)
+	headWidth := (keep + 1) / 2
+	return e.head(s, headWidth) + indicator + e.tail(s, keep-headWidth)
+}
+
+// like truncate, but shortens file paths by replacing whole
+// directories after the first with indicator, like /usr/…/bin/foo.
+// the base name is always kept.  values which can't be shortened that
+// way are truncated like truncate
+func (e *env) truncatePath(s string, width int, keepTail bool, indicator string) string {
+	if e.displayWidth(s) <= width {
+		return s
+	}
+	segments := strings.Split(s, "/")
+	first := 1
+	if segments[0] == "" {
+		first = 2 // an absolute path keeps its root too
+	}
+	last := len(segments) - 1
+	if last-first < 1 { // no directories to remove
+		return e.truncate(s, width, keepTail, indicator)
+	}
+
+	// keep as many directories nearest the base name as fit
+	prefix := strings.Join(segments[:first], "/") + "/" + indicator
+	suffix := "/" + segments[last]
+	if e.displayWidth(prefix+suffix) > width {
+		return e.truncate(s, width, keepTail, indicator)
+	}
+	for i := last - 1; i >= first; i-- {
+		longer := "/" + segments[i] + suffix
+		if e.displayWidth(prefix+longer) > width {
+			break
+		}
+		suffix = longer
+	}
+	return prefix + suffix
+}
+
+// clips line to fit within width columns.  if the line had to be
+// clipped, marker is placed in its final column(s).  a non-positive
+// width means there's no limit
+func (e *env) clipLine(line string, width int, marker string) string {
+	if width <= 0 || e.displayWidth(line) <= width {
+		return line
+	}
+	if e.displayWidth(strings.TrimRight(line, " ")) <= width {
+		return e.head(line, width) // only padding overflowed
+	}
+
+	markerWidth := e.displayWidth(marker)
+	if markerWidth > width {
+		return e.head(line, width)
+	}
+	return e.head(line, width-markerWidth) + marker
+}
+
+// stringList is a flag.Value which collects every use of a repeatable
+// flag
+type stringList []string
+
+func (list *stringList) String() string {
+	return strings.Join(*list, ", ")
+}
+
+func (list *stringList) Set(s string) error {
+	*list = append(*list, s)
+	return nil
+}
+
+// reports whether the named flag was given on the command line
+func isFlagSet(fs *flag.FlagSet, name string) bool {
+	found := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			found = true
+		}
+	})
+	return found
+}
+
+// reports a fatal error, returning the exit code for Run
+func (e *env) die(format string, args ...interface{}) int {
+	e.warn(format, args...)
+	return 1
+}
+
+func (e *env) warn(format string, args ...interface{}) {
+	if e.messages != nil {
+		fmt.Fprintf(e.messages, format+"\n", args...)
+	}
+}
+
+func (e *env) debug(format string, args ...interface{}) {
+	if e.isDebug {
+		e.warn(format, args...)
+	}
+}
+
+func on(delimiter byte) bufio.SplitFunc {
+	return func(data []byte, atEOF bool) (advance int, token []byte, err error) {
+		if atEOF {
+			if len(data) == 0 {
+				return 0, nil, nil
+			}
+
+			// we have a final, non-terminated record. Return it
+			return len(data), data, nil
+		}
+
+		if i := bytes.IndexByte(data, delimiter); i >= 0 {
+			// We have a delimited record
+			return i + 1, data[0:i], nil
+		}
+
+		// Request more data.
+		return 0, nil, nil
+	}
+}
+
+// ParseColumnSpecs parses a column spec description into specs keyed
+// by 0-based column index.  Columns chosen by header name, like
+// name:age, need the header, so they're an error here.
+func ParseColumnSpecs(specDescription string) (map[int]*ColumnSpec, error) {
+	specs, named, err := new(env).parseColumnSpecs(specDescription)
+	if err != nil {
+		return nil, err
+	}
+	if len(named) > 0 {
+		return nil, errors.New("columns chosen by name, like name:age, need a header")
+	}
+	return specs, nil
+}
+
+// returns specs plus the specs in named, keyed by the index of the
+// header field with their name.  a named spec replaces a numbered spec
+// for the same column
+func bindNames(specs map[int]*ColumnSpec, named map[string]*ColumnSpec, header []string) (map[int]*ColumnSpec, error) {
+	if len(named) == 0 {
+		return specs, nil
+	}
+	bound := make(map[int]*ColumnSpec, len(specs)+len(named))
+	for i, spec := range specs {
+		bound[i] = spec
+	}
+	for name, spec := range named {
+		found := false
+		for i, field := range header {
+			if field == name {
+				bound[i] = spec
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no column is named %q", name)
+		}
+	}
+	return bound, nil
+}
+
+// like ParseColumnSpecs, but also returns specs for columns chosen by
+// header name, keyed by name
+func (e *env) parseColumnSpecs(specDescription string) (map[int]*ColumnSpec, map[string]*ColumnSpec, error) {
+	// map column number to the associated spec
+	specs := make(map[int]*ColumnSpec)
+	named := make(map[string]*ColumnSpec)
+	maxColumn := 0
+
+	// parse each word of the spec description, noting where each
+	// word starts for error messages
+	scan := bufio.NewScanner(strings.NewReader(blankComments(specDescription)))
+	position, offset, consumed := 0, 0, 0
+	scan.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		advance, token, err := bufio.ScanWords(data, atEOF)
+		if token != nil {
+			// token is a slice of data, so their capacities differ
+			// by the token's offset within data
+			offset = consumed + cap(data) - cap(token)
+		}
+		consumed += advance
+		return advance, token, err
+	})
+	spec := NewColumnSpec()
+	needNewSpec := false
+	for scan.Scan() {
+		position++
+		if needNewSpec {
+			spec = NewColumnSpec()
+			needNewSpec = false
+		}
+
+		word := scan.Text()
+		e.debug("parsing %q", word)
+		if strings.HasSuffix(word, ";") {
+			needNewSpec = true
+			word = strings.TrimSuffix(word, ";")
+			e.debug("  now %q", word)
+			if word == "" { // ; on its own
+				continue
+			}
+		}
+
+		// column number like: 6 or 1 or 999.  negative numbers like
+		// -1 count from the last column
+		if n, err := strconv.Atoi(word); err == nil {
+			if n == 0 || n == DefaultColumn {
+				return nil, nil, fmt.Errorf("invalid column number: %d", n)
+			}
+			if n < 0 {
+				specs[n] = spec
+				continue
+			}
+			specs[n-1] = spec
+			if n > maxColumn {
+				maxColumn = n
+			}
+			continue
+		}
+
+		// column chosen by its header like: name:age
+		if strings.HasPrefix(word, "name:") {
+			name := strings.TrimPrefix(word, "name:")
+			if name == "" {
+				return nil, nil, fmt.Errorf("missing column name: %s", word)
+			}
+			named[name] = spec
+			continue
+		}
+
+		// spec for every column without its own, like: default 40c
+		if word == "default" {
+			specs[DefaultColumn] = spec
+			continue
+		}
+
+		// range of column numbers like: 3-7
+		if bounds := strings.Split(word, "-"); len(bounds) == 2 {
+			first, err1 := strconv.Atoi(bounds[0])
+			last, err2 := strconv.Atoi(bounds[1])
+			if err1 == nil && err2 == nil {
+				if first < 1 || last < first {
+					return nil, nil, fmt.Errorf("invalid column range: %s", word)
+				}
+				for n := first; n <= last; n++ {
+					specs[n-1] = spec
+				}
+				if last > maxColumn {
+					maxColumn = last
+				}
+				continue
+			}
+		}
+
+		// column width range like: 7c-20c or 10c-*
+		if bounds := strings.Split(word, "-"); len(bounds) == 2 {
+			e.debug("  width range: %v", bounds)
+			lower, ok, err := parseColumnWidth(bounds[0])
+			if err != nil {
+				return nil, nil, err
+			}
+			if ok {
+				e.debug("    lower = %d", lower)
+				upper, ok, err := parseColumnWidth(bounds[1])
+				if err != nil {
+					return nil, nil, err
+				}
+				if ok {
+					e.debug("    upper = %d", upper)
+					if upper >= 0 && lower > upper {
+						return nil, nil, fmt.Errorf("invalid width range: min %d greater than max %d", lower, upper)
+					}
+					spec.WidthMin = lower
+					spec.WidthMax = upper
+					continue
+				}
+			}
+		}
+
+		// column width in characters like: 7c or 63c
+		width, ok, err := parseColumnWidth(word)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ok {
+			spec.WidthMin = width
+			spec.WidthMax = width
+			continue
+		}
+
+		// weight of a flexible column like: 2x
+		if strings.HasSuffix(word, "x") {
+			if weight, err := strconv.Atoi(strings.TrimSuffix(word, "x")); err == nil {
+				if weight < 1 {
+					return nil, nil, fmt.Errorf("invalid column weight: %s", word)
+				}
+				spec.Weight = weight
+				continue
+			}
+		}
+
+		// column width relative to the terminal like: 30%
+		if strings.HasSuffix(word, "%") {
+			percent, err := strconv.Atoi(strings.TrimSuffix(word, "%"))
+			if err != nil || percent < 1 || percent > 100 {
+				return nil, nil, fmt.Errorf("invalid width percentage: %s", word)
+			}
+			spec.WidthPercent = percent
+			continue
+		}
+
+		// enum mapping like: enum:DEBUG=DBG,ERROR=ERR:red
+		if strings.HasPrefix(word, "enum:") {
+			mapping, enumColors, err := parseEnumMapping(strings.TrimPrefix(word, "enum:"))
+			if err != nil {
+				return nil, nil, err
+			}
+			spec.Type = TypeEnum
+			spec.Enum = mapping
+			spec.EnumColors = enumColors
+			continue
+		}
+
+		// character groups like: group:3,3,4 or group:2/:
+		if strings.HasPrefix(word, "group:") {
+			sizes, separator, err := parseGroupPattern(strings.TrimPrefix(word, "group:"))
+			if err != nil {
+				return nil, nil, err
+			}
+			spec.Type = TypeGroup
+			spec.Group = sizes
+			spec.GroupSeparator = separator
+			continue
+		}
+
+		// bar with a fixed target like: bar:target=100
+		if strings.HasPrefix(word, "bar:target=") {
+			target, err := strconv.ParseFloat(strings.TrimPrefix(word, "bar:target="), 64)
+			if err != nil || target <= 0 {
+				return nil, nil, fmt.Errorf("invalid bar target: %s", word)
+			}
+			spec.Type = TypeBar
+			spec.BarTarget = target
+			continue
+		}
+
+		// numeric scale factor like: scale:0.001
+		if strings.HasPrefix(word, "scale:") {
+			factor, err := strconv.ParseFloat(strings.TrimPrefix(word, "scale:"), 64)
+			if err != nil || factor == 0 {
+				return nil, nil, fmt.Errorf("invalid scale: %s", word)
+			}
+			spec.Scale = factor
+			continue
+		}
+
+		// decimal places like: decimals:2
+		if strings.HasPrefix(word, "decimals:") {
+			n, err := strconv.Atoi(strings.TrimPrefix(word, "decimals:"))
+			if err != nil || n < 0 {
+				return nil, nil, fmt.Errorf("invalid decimals: %s", word)
+			}
+			spec.Decimals = n
+			continue
+		}
+
+		// threshold colors like: heat:100=yellow,500=red
+		if strings.HasPrefix(word, "heat:") {
+			bands, err := parseHeatBands(strings.TrimPrefix(word, "heat:"))
+			if err != nil {
+				return nil, nil, err
+			}
+			spec.Heat = bands
+			continue
+		}
+
+		// aggregate for the summary row like: total:avg
+		if strings.HasPrefix(word, "total:") {
+			fn := strings.TrimPrefix(word, "total:")
+			switch fn {
+			case "sum", "avg", "min", "max", "count":
+			default:
+				return nil, nil, fmt.Errorf("unknown total: %s", fn)
+			}
+			spec.Total = fn
+			continue
+		}
+
+		// placeholder for blank cells like: empty:-
+		if strings.HasPrefix(word, "empty:") {
+			spec.Empty = strings.TrimPrefix(word, "empty:")
+			continue
+		}
+
+		// padding character like: fill:.
+		if strings.HasPrefix(word, "fill:") {
+			fill := strings.TrimPrefix(word, "fill:")
+			if !isFillChar(fill) {
+				return nil, nil, fmt.Errorf("fill must be a single character, one column wide: %s", word)
+			}
+			spec.Fill = fill
+			continue
+		}
+
+		// foreground color like: fg:cyan
+		if strings.HasPrefix(word, "fg:") {
+			name := strings.TrimPrefix(word, "fg:")
+			color, ok := colors[name]
+			if !ok {
+				return nil, nil, fmt.Errorf("unknown color: %s", name)
+			}
+			spec.Color = color
+			continue
+		}
+
+		// date with a layout like: date:2006-01-02
+		if strings.HasPrefix(word, "date:") {
+			spec.Type = TypeDate
+			spec.DateLayout = strings.TrimPrefix(word, "date:")
+			continue
+		}
+
+		// keywords
+		switch word {
+		case "bar":
+			spec.Type = TypeBar
+		case "bool":
+			spec.Type = TypeBool
+		case "percent", "percent:100":
+			spec.Type = TypePercent
+			spec.PercentPoints = word == "percent:100"
+			if !spec.explicitAlign {
+				spec.Align = AlignRight
+			}
+		case "age":
+			spec.Type = TypeAge
+			if !spec.explicitAlign {
+				spec.Align = AlignRight
+			}
+		case "clock":
+			spec.Type = TypeDuration
+			spec.Clock = true
+		case "duration":
+			spec.Type = TypeDuration
+			spec.Clock = false
+			if !spec.explicitAlign {
+				spec.Align = AlignRight
+			}
+		case "ip", "ip:space":
+			spec.Type = TypeIP
+			spec.ZeroPad = false
+		case "ip:zero":
+			spec.Type = TypeIP
+			spec.ZeroPad = true
+		case "center":
+			spec.Align = AlignCenter
+			spec.explicitAlign = true
+		case "date":
+			spec.Type = TypeDate
+		case "decimal":
+			spec.Align = AlignRight
+			spec.AlignDecimal = true
+			spec.explicitAlign = true
+		case "hide":
+			spec.Hidden = true
+		case "upper", "lower", "title":
+			spec.Case = word
+		case "trim":
+			spec.Trim = true
+		case "wrap":
+			spec.Wrap = true
+		case "trunc-left":
+			spec.Truncation = TruncateLeft
+		case "trunc-mid":
+			spec.Truncation = TruncateMiddle
+		case "path":
+			spec.Truncation = TruncatePath
+		case "delta":
+			spec.Delta = true
+			if !spec.explicitAlign {
+				spec.Align = AlignRight
+			}
+		case "left":
+			spec.Align = AlignLeft
+			spec.explicitAlign = true
+		case "num":
+			spec.Type = TypeNumber
+			if !spec.explicitAlign {
+				spec.Align = AlignRight
+			}
+		case "ordinal":
+			spec.Type = TypeOrdinal
+		case "right":
+			spec.Align = AlignRight
+			spec.explicitAlign = true
+		default:
+			return nil, nil, fmt.Errorf("unexpected token %q at position %d (byte %d)", word, position, offset)
+		}
+	}
+	if err := scan.Err(); err != nil {
+		return nil, nil, err
+	}
+	for _, spec := range specs {
+		if err := checkDelta(spec); err != nil {
+			return nil, nil, err
+		}
+	}
+	for _, spec := range named {
+		if err := checkDelta(spec); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return specs, named, nil
+}
+
+// deltas compare values after they're rendered, which leaves only
+// plain and num columns numeric
+func checkDelta(spec *ColumnSpec) error {
+	if spec.Delta && spec.Type != TypeString && spec.Type != TypeNumber {
+		return fmt.Errorf("delta can't be used with %s columns", spec.Type)
+	}
+	return nil
+}
+
+// replaces comments in a column spec with spaces, so later words keep
+// their offsets.  a comment runs from a word starting with # to the
+// end of the line, so # inside a word, like empty:#, isn't a comment
+func blankComments(spec string) string {
+	b := []byte(spec)
+	inComment := false
+	for i, c := range b {
+		if c == '\n' {
+			inComment = false
+		} else if c == '#' && (i == 0 || unicode.IsSpace(rune(spec[i-1]))) {
+			inComment = true
+		}
+		if inComment {
+			b[i] = ' '
+		}
+	}
+	return string(b)
+}
+
+// returns the width of a column specification, or -1 if the column
+// has an infinite width.  the bool is false if word isn't a width
+func parseColumnWidth(word string) (int, bool, error) {
+	// unbounded width like: *
+	if word == "*" {
+		return -1, true, nil
+	}
+
+	// width in characters like: 7c or 42c.  words which start like a
+	// number were meant as widths, so they're an error if malformed
+	if !strings.HasSuffix(word, "c") || strings.IndexAny(word[:1], "-0123456789") < 0 {
+		return 0, false, nil
+	}
+	body := strings.TrimSuffix(word, "c")
+	width, err := strconv.Atoi(body)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid width: %s", body)
+	}
+	if width < 0 {
+		return 0, false, fmt.Errorf("negative width: %s", word)
+	}
+	return width, true, nil
+}
+
+// parses an enum mapping like: DEBUG=DBG,INFO=INF,WARN=WRN:yellow
+// where the optional text after : names the symbol's color.  returns
+// the symbol for each value and the escape sequence for each colored
+// symbol
+func parseEnumMapping(description string) (map[string]string, map[string]string, error) {
+	mapping := make(map[string]string)
+	var symbolColors map[string]string
+	for _, pair := range strings.Split(description, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, nil, fmt.Errorf("invalid enum mapping: %s", pair)
+		}
+		symbol := parts[1]
+		if i := strings.LastIndex(symbol, ":"); i >= 0 {
+			name := symbol[i+1:]
+			color, ok := colors[name]
+			if !ok {
+				return nil, nil, fmt.Errorf("unknown color: %s", name)
+			}
+			symbol = symbol[0:i]
+			if symbolColors == nil {
+				symbolColors = make(map[string]string)
+			}
+			symbolColors[symbol] = color
+		}
+		mapping[parts[0]] = symbol
+	}
+	return mapping, symbolColors, nil
+}
+
+// renders a value as its enum symbol.  values without a symbol are
+// passed through, truncated to the width of the widest symbol so the
+// column stays uniform.
+func (e *env) renderEnum(s string, symbols map[string]string) string {
+	if symbol, ok := symbols[s]; ok {
+		return symbol
+	}
+
+	width := 0
+	for _, symbol := range symbols {
+		if w := e.displayWidth(symbol); w > width {
+			width = w
+		}
+	}
+	return e.head(s, width)
+}
 
-	// adjust column widths based on specs
-	for i, width := range widths {
-		spec, ok := specs[i]
-		if !ok {
-			continue
+// parses a group pattern like 3,3,4 or 2/: where the optional text
+// after / is the separator (default -)
+func parseGroupPattern(description string) ([]int, string, error) {
+	separator := "-"
+	if i := strings.Index(description, "/"); i >= 0 {
+		separator = description[i+1:]
+		description = description[0:i]
+	}
+
+	var sizes []int
+	for _, field := range strings.Split(description, ",") {
+		size, err := strconv.Atoi(field)
+		if err != nil || size < 1 {
+			return nil, "", fmt.Errorf("invalid group size: %s", field)
 		}
+		sizes = append(sizes, size)
+	}
+	return sizes, separator, nil
+}
 
-		if width < spec.WidthMin {
-			widths[i] = spec.WidthMin
+// renders a value with separator inserted between groups of
+// characters.  a single size splits the value into equal groups, so
+// its length must be a multiple of that size.  several sizes must add
+// up to the value's length.  if there's an error, returns the original
+// string
+func renderGroup(s string, sizes []int, separator string) (string, error) {
+	runes := []rune(s)
+	if len(sizes) == 1 {
+		size := sizes[0]
+		if len(runes) == 0 || len(runes)%size != 0 {
+			return s, fmt.Errorf("length %d is not a multiple of %d", len(runes), size)
 		}
-		if spec.WidthMax >= 0 && width > spec.WidthMax {
-			widths[i] = spec.WidthMax
+		sizes = make([]int, len(runes)/size)
+		for i := range sizes {
+			sizes[i] = size
 		}
 	}
-	debug("widths = %v", widths)
-	widths = rebalanceWidths(widths, specs)
-	debug("rebalanced = %v", widths)
 
-	// create format strings
-	formats := make([]string, len(widths))
-	for i, width := range widths {
-		alignment := "-"
-		if spec, ok := specs[i]; ok && spec.Align == AlignRight {
-			alignment = ""
-		}
-		formats[i] = "%" + alignment + strconv.Itoa(width) + "s"
+	total := 0
+	for _, size := range sizes {
+		total += size
+	}
+	if total != len(runes) {
+		return s, fmt.Errorf("length %d doesn't match pattern length %d", len(runes), total)
 	}
 
-	// output formatted data
-	columns := make([]string, 0, len(widths))
-	for _, row := range rows {
-		columns = columns[:0] // empty the slice, reusing same memory
-		for i, format := range formats {
-			if widths[i] == 0 { // skip zero-width columns
-				continue
-			}
-			if len(row[i]) > widths[i] {
-				// truncate column
-				row[i] = row[i][0:widths[i]]
-				//fmt.Fprintf(os.Stderr, "truncated to %q\n", row[i])
-			}
-			columns = append(columns, fmt.Sprintf(format, row[i]))
-		}
-		line := strings.Join(columns, outputFieldSeparator)
-		io.WriteString(os.Stdout, line)
-		io.WriteString(os.Stdout, outputRecordSeparator)
+	groups := make([]string, len(sizes))
+	for i, size := range sizes {
+		groups[i] = string(runes[0:size])
+		runes = runes[size:]
 	}
+	return strings.Join(groups, separator), nil
 }
 
-func die(format string, args ...interface{}) {
-	fmt.Fprintf(os.Stderr, format+"\n", args...)
-	os.Exit(1)
-}
+// renders an IPv4 address with each octet padded to three digits, so
+// the dots line up vertically.  if there's an error, returns the
+// original string
+func renderIP(s string, zeroPad bool) (string, error) {
+	ip := net.ParseIP(s).To4()
+	if ip == nil || strings.Count(s, ".") != 3 {
+		return s, errors.New("can't parse as an IPv4 address: " + s)
+	}
 
-func warn(format string, args ...interface{}) {
-	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	format := "%3d.%3d.%3d.%3d"
+	if zeroPad {
+		format = "%03d.%03d.%03d.%03d"
+	}
+	return fmt.Sprintf(format, ip[0], ip[1], ip[2], ip[3]), nil
 }
 
-func debug(format string, args ...interface{}) {
-	if isDebug {
-		fmt.Fprintf(os.Stderr, format+"\n", args...)
+// multiplies a numeric value by factor, showing the given number of
+// decimal places (-1 for as many as necessary).  if there's an error,
+// returns the original string
+func renderScaled(s string, factor float64, decimals int) (string, error) {
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return s, errors.New("can't parse as a number: " + s)
 	}
+	return strconv.FormatFloat(n*factor, 'f', decimals, 64), nil
 }
 
-func on(delimiter byte) bufio.SplitFunc {
-	return func(data []byte, atEOF bool) (advance int, token []byte, err error) {
-		if atEOF {
-			if len(data) == 0 {
-				return 0, nil, nil
-			}
+// renders a ratio like 0.8734 as a percentage like 87.3%.  if points
+// is true, the value is already a percentage.  decimals is the number
+// of decimal places to show (-1 for 1).  if there's an error, returns
+// the original string
+func renderPercent(s string, points bool, decimals int) (string, error) {
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return s, errors.New("can't parse as a number: " + s)
+	}
+	if !points {
+		n *= 100
+	}
+	if decimals < 0 {
+		decimals = 1
+	}
+	return strconv.FormatFloat(n, 'f', decimals, 64) + "%", nil
+}
 
-			// we have a final, non-terminated record. Return it
-			return len(data), data, nil
-		}
+// matches plain decimal numbers like -1234.5
+var plainNumber = regexp.MustCompile(`^[-+]?[0-9]+(\.[0-9]+)?$`)
 
-		if i := bytes.IndexByte(data, delimiter); i >= 0 {
-			// We have a delimited record
-			return i + 1, data[0:i], nil
-		}
+// renders a number with commas separating groups of thousands, like
+// 1,234,567.89.  decimals is the number of decimal places to show (-1
+// for as many as the value has).  if there's an error, returns the
+// original string
+func renderNumber(s string, decimals int) (string, error) {
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return s, errors.New("can't parse as a number: " + s)
+	}
+	digits := s
+	if decimals >= 0 || !plainNumber.MatchString(s) {
+		digits = strconv.FormatFloat(n, 'f', decimals, 64)
+	}
 
-		// Request more data.
-		return 0, nil, nil
+	sign := ""
+	if digits[0] == '-' || digits[0] == '+' {
+		sign, digits = digits[0:1], digits[1:]
+	}
+	fraction := ""
+	if i := strings.IndexByte(digits, '.'); i >= 0 {
+		digits, fraction = digits[0:i], digits[i:]
 	}
+	return sign + groupThousands(digits) + fraction, nil
 }
 
-func ParseColumnSpecs(specDescription string) (map[int]*ColumnSpec, error) {
-	// map column number to the associated spec
-	specs := make(map[int]*ColumnSpec)
-	maxColumn := 0
+// parses a number which may have been rendered with commas between
+// groups of thousands
+func parseNumber(s string) (float64, error) {
+	return strconv.ParseFloat(strings.Replace(strings.TrimSpace(s), ",", "", -1), 64)
+}
 
-	// parse each word of the spec description
-	scan := bufio.NewScanner(strings.NewReader(specDescription))
-	scan.Split(bufio.ScanWords)
-	spec := &ColumnSpec{}
-	needNewSpec := false
-	for scan.Scan() {
-		if needNewSpec {
-			spec = &ColumnSpec{}
-			needNewSpec = false
+// inserts commas between groups of three digits, counting from the right
+func groupThousands(digits string) string {
+	var grouped strings.Builder
+	for i, digit := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			grouped.WriteByte(',')
 		}
+		grouped.WriteRune(digit)
+	}
+	return grouped.String()
+}
 
-		word := scan.Text()
-		debug("parsing %q", word)
-		if strings.HasSuffix(word, ";") {
-			needNewSpec = true
-			word = strings.TrimSuffix(word, ";")
-			debug("  now %q", word)
-		}
+var defaultBarWidth = 10
 
-		// column number like: 6 or 1 or 999
-		if n, err := strconv.Atoi(word); err == nil {
-			if n < 1 {
-				return nil, fmt.Errorf("invalid column number: %d", n)
-			}
-			specs[n-1] = spec
-			if n > maxColumn {
-				maxColumn = n
-			}
-			continue
-		}
+// eighths of a block, used for the fractional end of a bar
+var barBlocks = []rune(" ▏▎▍▌▋▊▉█")
 
-		// column width in characters like: 7c or 63c
-		if width, ok := parseColumnWidth(word); ok {
-			spec.WidthMin = width
-			spec.WidthMax = width
-			continue
-		}
+// SGR escape sequences for each color name
+var colors = map[string]string{
+	"black":   "\x1b[30m",
+	"red":     "\x1b[31m",
+	"green":   "\x1b[32m",
+	"yellow":  "\x1b[33m",
+	"blue":    "\x1b[34m",
+	"magenta": "\x1b[35m",
+	"cyan":    "\x1b[36m",
+	"white":   "\x1b[37m",
+}
 
-		// column width range like: 7c-20c or 10c-*
-		if bounds := strings.Split(word, "-"); len(bounds) == 2 {
-			debug("  width range: %v", bounds)
-			if lower, ok := parseColumnWidth(bounds[0]); ok {
-				debug("    lower = %d", lower)
-				if upper, ok := parseColumnWidth(bounds[1]); ok {
-					debug("    upper = %d", upper)
-					spec.WidthMin = lower
-					spec.WidthMax = upper
-					continue
-				}
-			}
-		}
+const sgrReset = "\x1b[0m"
 
-		// keywords
-		switch word {
-		case ";":
-			needNewSpec = true
-		case "age":
-			spec.Type = TypeAge
-		case "left":
-			spec.Align = AlignLeft
-		case "right":
-			spec.Align = AlignRight
-		default:
-			return nil, fmt.Errorf("unexpected token: %s", word)
+// sgrStripe marks alternate rows for -zebra
+const sgrStripe = "\x1b[2m"
+
+// parses heat bands like: 100=yellow,500=red
+func parseHeatBands(description string) ([]HeatBand, error) {
+	var bands []HeatBand
+	for _, pair := range strings.Split(description, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid heat band: %s", pair)
 		}
+		threshold, err := strconv.ParseFloat(parts[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid heat threshold: %s", parts[0])
+		}
+		color, ok := colors[parts[1]]
+		if !ok {
+			return nil, fmt.Errorf("unknown color: %s", parts[1])
+		}
+		bands = append(bands, HeatBand{Threshold: threshold, Color: color})
 	}
-	if err := scan.Err(); err != nil {
-		return nil, err
-	}
-
-	return specs, nil
+	sort.Slice(bands, func(i, j int) bool {
+		return bands[i].Threshold < bands[j].Threshold
+	})
+	return bands, nil
 }
 
-// returns the width of a column specification, or -1 if the column
-// has an infinite width
-func parseColumnWidth(word string) (int, bool) {
-	// width in characters like: 7c or 42c
-	if strings.HasSuffix(word, "c") {
-		width, err := strconv.Atoi(strings.TrimSuffix(word, "c"))
-		if err == nil {
-			return width, true
+// returns the color of the highest band whose threshold a numeric
+// value reaches.  returns "" for values below every band and for
+// non-numeric values
+func heatColor(s string, bands []HeatBand) string {
+	value, err := parseNumber(s)
+	if err != nil {
+		return ""
+	}
+
+	color := ""
+	for _, band := range bands {
+		if value >= band.Threshold {
+			color = band.Color
 		}
 	}
+	return color
+}
 
-	// unbounded width like: *
-	if word == "*" {
-		return -1, true
+// renders a numeric value as a bar exactly width characters wide,
+// where target fills the entire width.  reports whether the value
+// exceeded target.  non-numeric values render as a blank bar, with a
+// warning.  so do all values if target isn't positive
+func (e *env) renderBar(s string, target float64, width int) (string, bool) {
+	value, err := parseNumber(s)
+	if err != nil {
+		e.warn("Unexpected number format: %q", s)
+		return strings.Repeat(" ", width), false
+	}
+	if target <= 0 {
+		return strings.Repeat(" ", width), false
 	}
 
-	return 0, false
+	over := value > target
+	if over {
+		value = target
+	}
+	if value < 0 {
+		value = 0
+	}
+	eighths := int(value / target * float64(width*8))
+	bar := strings.Repeat(string(barBlocks[8]), eighths/8)
+	if eighths%8 > 0 {
+		bar += string(barBlocks[eighths%8])
+	}
+	return e.pad(bar, width, AlignLeft, " "), over
 }
 
 var timeLayouts = []string{
@@ -325,66 +3566,186 @@ var timeLayouts = []string{
 	time.UnixDate,
 }
 
-// tries to render a given string as an age column.  if there's an
-// error, returns the original string
-func renderAge(s string) (string, error) {
-	for _, layout := range timeLayouts {
-		t, err := time.Parse(layout, s)
-		if err == nil {
-			d := time.Since(t)
-			if seconds := d.Seconds(); seconds < 90 {
-				return fmt.Sprintf("%ds", int(seconds)), nil
-			}
-			if minutes := d.Minutes(); minutes < 90 {
-				return fmt.Sprintf("%dm", int(minutes)), nil
-			}
-			if hours := d.Hours(); hours < 24 {
-				return fmt.Sprintf("%dh", int(hours)), nil
-			}
-			if days := d.Hours() / 24; days < 30 {
-				return fmt.Sprintf("%dd", int(days)), nil
-			}
-			if months := d.Hours() / 24 / 30; months < 12 {
-				return fmt.Sprintf("%dM", int(months)), nil
-			}
-			return strconv.Itoa(t.Year()), nil
+// matches ages which are already relative, like 5m or 3d
+var relativeAge = regexp.MustCompile(`^(in )?-?[0-9]+[smhdwMy]$`)
+
+// plausible range for timestamps given as seconds since the Unix
+// epoch: 1973 through 2286.  13 digit values in the same range are
+// taken as milliseconds.
+const minEpochSeconds = 100000000
+const maxEpochSeconds = 9999999999
+const minEpochMillis = 1000000000000
+const maxEpochMillis = 9999999999999
+
+// parses a timestamp written as seconds or milliseconds since the Unix
+// epoch or in one of timeLayouts
+func (e *env) parseTime(s string) (time.Time, error) {
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		if n >= minEpochSeconds && n <= maxEpochSeconds {
+			return time.Unix(n, 0), nil
+		}
+		if n >= minEpochMillis && n <= maxEpochMillis {
+			return time.Unix(n/1000, n%1000*int64(time.Millisecond)), nil
+		}
+	}
+	for _, layout := range append(e.timeLayouts, timeLayouts...) {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
 		}
 	}
-	return s, errors.New("can't parse as a time: " + s)
+	return time.Time{}, errors.New("can't parse as a time: " + s)
 }
 
-// adjust widths to fit within a terminal's available horizontal space
-func rebalanceWidths(widths []int, specs map[int]*ColumnSpec) []int {
-	// how much horizontal space is available?
-	availableWidth := terminalWidth
+// AgeTier is one unit in which ages may be shown.
+type AgeTier struct {
+	// Suffix follows the number of units, like "m" in 5m
+	Suffix string
 
-	// how much horizontal space have we consumed?
-	consumedWidth := 0
-	for i, width := range widths {
-		consumedWidth += width
-		if i > 0 {
-			consumedWidth += 2 // account for gutters
+	// Size is the length of one unit
+	Size time.Duration
+
+	// Limit is the number of units at which the next tier takes over
+	Limit float64
+}
+
+// AgeScale describes how ages are rendered.
+type AgeScale struct {
+	// Tiers are tried from smallest to largest.  the first whose
+	// Limit exceeds the age is used.
+	Tiers []AgeTier
+
+	// ShowYear renders ages beyond the last tier as the timestamp's
+	// year.  otherwise, they're shown in the last tier's unit.
+	ShowYear bool
+}
+
+// units which may appear in an age scale, by suffix
+var ageUnits = map[string]time.Duration{
+	"s": time.Second,
+	"m": time.Minute,
+	"h": time.Hour,
+	"d": 24 * time.Hour,
+	"w": 7 * 24 * time.Hour,
+	"M": 30 * 24 * time.Hour,
+	"y": 365 * 24 * time.Hour,
+}
+
+var defaultAgeScale = AgeScale{
+	Tiers: []AgeTier{
+		{"s", time.Second, 90},
+		{"m", time.Minute, 90},
+		{"h", time.Hour, 24},
+		{"d", 24 * time.Hour, 14},
+		{"w", 7 * 24 * time.Hour, 60.0 / 7}, // until 60 days
+		{"M", 30 * 24 * time.Hour, 12},
+	},
+	ShowYear: true,
+}
+
+// tiers of defaultAgeScale, without weeks
+var ageTiersWithoutWeeks = []AgeTier{
+	{"s", time.Second, 90},
+	{"m", time.Minute, 90},
+	{"h", time.Hour, 24},
+	{"d", 24 * time.Hour, 30},
+	{"M", 30 * 24 * time.Hour, 12},
+}
+
+// parses age tiers like: s:90,m:180,h:24,d:14,w:8,M:12
+func parseAgeTiers(description string) ([]AgeTier, error) {
+	var tiers []AgeTier
+	for _, pair := range strings.Split(description, ",") {
+		parts := strings.SplitN(pair, ":", 2)
+		size, ok := ageUnits[parts[0]]
+		if !ok {
+			return nil, fmt.Errorf("unknown age unit: %s", parts[0])
+		}
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("missing limit for age unit: %s", parts[0])
+		}
+		limit, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil || limit <= 0 {
+			return nil, fmt.Errorf("invalid limit for age unit %s: %s", parts[0], parts[1])
+		}
+		tiers = append(tiers, AgeTier{Suffix: parts[0], Size: size, Limit: limit})
+	}
+	return tiers, nil
+}
+
+// tries to render a given string as an age column.  values which are
+// already relative ages pass through unchanged.  timestamps in the
+// future render like "in 5m".  if there's an error, returns the
+// original string
+func (e *env) renderAge(s string, scale AgeScale) (string, error) {
+	if relativeAge.MatchString(s) {
+		return s, nil
+	}
+	t, err := e.parseTime(s)
+	if err != nil {
+		return s, err
+	}
+
+	d := e.now().Sub(t)
+	prefix := ""
+	if d < 0 {
+		prefix = "in "
+		d = -d
+	}
+	for _, tier := range scale.Tiers {
+		if n := float64(d) / float64(tier.Size); n < tier.Limit {
+			return fmt.Sprintf("%s%d%s", prefix, int(n), tier.Suffix), nil
 		}
 	}
+	if scale.ShowYear || len(scale.Tiers) == 0 {
+		return strconv.Itoa(t.Year()), nil
+	}
+	last := scale.Tiers[len(scale.Tiers)-1]
+	return fmt.Sprintf("%s%d%s", prefix, int(d/last.Size), last.Suffix), nil
+}
+
+// renders a timestamp in a canonical layout.  an empty layout means
+// dateLayout.  if there's an error, returns the original string
+func (e *env) renderDate(s string, layout string) (string, error) {
+	t, err := e.parseTime(s)
+	if err != nil {
+		return s, err
+	}
+	if layout == "" {
+		layout = e.dateLayout
+	}
+	return t.Format(layout), nil
+}
+
+// adjust widths to fit within a terminal's available horizontal space.
+// gutter is the width of the separator between columns.  a
+// non-positive availableWidth means the space is unlimited, so widths
+// are left alone
+func (e *env) rebalanceWidths(widths []int, specs map[int]*ColumnSpec, availableWidth int, gutter int) []int {
+	if availableWidth <= 0 {
+		return widths
+	}
+
+	// how much horizontal space have we consumed?
+	consumedWidth := tableWidth(widths, gutter)
 
 	// which column widths can be adjusted?
 	adjustable := make(map[int]*ColumnSpec)
 	for i, spec := range specs {
-		if spec.HasFlexibleWidth() && widths[i] > spec.WidthMin {
+		if i < len(widths) && spec.HasFlexibleWidth() && widths[i] > spec.WidthMin {
 			adjustable[i] = spec
 		}
 	}
 
 	// reduce widths until everything fits in the space allowed
-	debug("rebalancing %d towards %d", consumedWidth, availableWidth)
+	e.debug("rebalancing %d towards %d", consumedWidth, availableWidth)
 	for consumedWidth > availableWidth && len(adjustable) > 0 {
-		// find the widest adjustable column
+		// find the widest adjustable column, scaled by weight
 		widestIndex := 0
 		widestWidth := 0
-		for i := range adjustable {
-			if widths[i] > widestWidth {
+		for i, spec := range adjustable {
+			if width := widths[i] * spec.weight(); width > widestWidth {
 				widestIndex = i
-				widestWidth = widths[i]
+				widestWidth = width
 			}
 		}
 
@@ -398,3 +3759,277 @@ func rebalanceWidths(widths []int, specs map[int]*ColumnSpec) []int {
 
 	return widths
 }
+
+// like rebalanceWidths, but shrinks every adjustable column in
+// proportion to how far it is above its WidthMin, scaled by its
+// weight, rather than always shrinking the widest
+func rebalanceProportionally(widths []int, specs map[int]*ColumnSpec, availableWidth int, gutter int) []int {
+	excess := tableWidth(widths, gutter) - availableWidth
+	if availableWidth <= 0 || excess <= 0 {
+		return widths
+	}
+
+	// how much can each adjustable column give up?
+	var adjustable []int
+	slack := make(map[int]int)
+	totalSlack := 0
+	for i, spec := range specs {
+		if i < len(widths) && spec.HasFlexibleWidth() && widths[i] > spec.WidthMin {
+			adjustable = append(adjustable, i)
+			slack[i] = widths[i] - spec.WidthMin
+			totalSlack += slack[i]
+		}
+	}
+	if excess >= totalSlack {
+		for _, i := range adjustable {
+			widths[i] -= slack[i]
+		}
+		return widths
+	}
+
+	// shrink columns in rounds, since a heavily weighted column may
+	// run out of slack before it's taken its full share
+	sort.Ints(adjustable)
+	for excess > 0 {
+		shares := 0
+		for _, i := range adjustable {
+			shares += slack[i] * specs[i].weight()
+		}
+
+		// shrink each column by its share, rounded down.  the columns
+		// which lost most to rounding make up the difference
+		remainder := make(map[int]int)
+		leftover := excess
+		for _, i := range adjustable {
+			share := slack[i] * specs[i].weight()
+			cut := excess * share / shares
+			remainder[i] = excess * share % shares
+			if cut > slack[i] {
+				cut, remainder[i] = slack[i], 0
+			}
+			widths[i] -= cut
+			slack[i] -= cut
+			leftover -= cut
+		}
+		byRemainder := append([]int(nil), adjustable...)
+		sort.SliceStable(byRemainder, func(a, b int) bool {
+			return remainder[byRemainder[a]] > remainder[byRemainder[b]]
+		})
+		for _, i := range byRemainder {
+			if leftover > 0 && remainder[i] > 0 && slack[i] > 0 {
+				widths[i]--
+				slack[i]--
+				leftover--
+			}
+		}
+		excess = leftover
+
+		// columns without slack drop out of later rounds
+		kept := adjustable[:0]
+		for _, i := range adjustable {
+			if slack[i] > 0 {
+				kept = append(kept, i)
+			}
+		}
+		adjustable = kept
+	}
+	return widths
+}
+
+// widens flexible columns until the table fills availableWidth.  the
+// narrowest column grows first, so extra space is shared fairly.
+// columns don't grow beyond their WidthMax.
+func (e *env) growWidths(widths []int, specs map[int]*ColumnSpec, availableWidth int, gutter int) []int {
+	consumedWidth := tableWidth(widths, gutter)
+
+	// which column widths can be adjusted?
+	growable := make(map[int]*ColumnSpec)
+	for i, spec := range specs {
+		if i < len(widths) && widths[i] > 0 && spec.HasFlexibleWidth() && !spec.Hidden {
+			if spec.WidthMax < 0 || widths[i] < spec.WidthMax {
+				growable[i] = spec
+			}
+		}
+	}
+
+	// increase widths until the space allowed is filled
+	e.debug("growing %d towards %d", consumedWidth, availableWidth)
+	for consumedWidth < availableWidth && len(growable) > 0 {
+		// find the narrowest growable column, scaled by weight.
+		// widths are compared as width/weight, cross-multiplied
+		narrowestIndex := -1
+		for i, spec := range growable {
+			if narrowestIndex < 0 {
+				narrowestIndex = i
+				continue
+			}
+			scaled := widths[i] * growable[narrowestIndex].weight()
+			narrowest := widths[narrowestIndex] * spec.weight()
+			if scaled < narrowest || (scaled == narrowest && i < narrowestIndex) {
+				narrowestIndex = i
+			}
+		}
+
+		// increase its width by 1 character
+		widths[narrowestIndex]++
+		consumedWidth++
+		if max := growable[narrowestIndex].WidthMax; max >= 0 && widths[narrowestIndex] >= max {
+			delete(growable, narrowestIndex)
+		}
+	}
+
+	return widths
+}
+
+// returns the number of columns needed to print a table whose
+// columns have widths, separated by gutter.  zero-width columns aren't
+// printed, so they don't need a gutter
+func tableWidth(widths []int, gutter int) int {
+	total := 0
+	printed := 0
+	for _, width := range widths {
+		if width == 0 {
+			continue
+		}
+		if printed > 0 {
+			total += gutter
+		}
+		total += width
+		printed++
+	}
+	return total
+}
+
+// parses a duration written either as a number of seconds like 5400
+// or as a Go duration like 1h30m
+func parseDuration(s string) (time.Duration, error) {
+	if seconds, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+	return time.ParseDuration(s)
+}
+
+// units used when rendering durations, largest first
+var durationUnits = []struct {
+	Suffix string
+	Size   time.Duration
+}{
+	{"d", 24 * time.Hour},
+	{"h", time.Hour},
+	{"m", time.Minute},
+	{"s", time.Second},
+}
+
+// renders a duration column in a compact form like 1h30m or 2d3h,
+// showing at most the two largest units.  durations under a second are
+// shown in milliseconds.  if there's an error, returns the original
+// string
+func renderDuration(s string) (string, error) {
+	d, err := parseDuration(s)
+	if err != nil {
+		return s, errors.New("can't parse as a duration: " + s)
+	}
+
+	sign := ""
+	if d < 0 {
+		sign = "-"
+		d = -d
+	}
+	if d == 0 {
+		return "0s", nil
+	}
+	if d < time.Second {
+		return fmt.Sprintf("%s%dms", sign, d/time.Millisecond), nil
+	}
+
+	rendered := sign
+	shown := 0
+	for _, unit := range durationUnits {
+		n := d / unit.Size
+		d -= n * unit.Size
+		if n == 0 && shown == 0 {
+			continue
+		}
+		if n > 0 {
+			rendered += fmt.Sprintf("%d%s", n, unit.Suffix)
+		}
+		if shown++; shown == 2 {
+			break
+		}
+	}
+	return rendered, nil
+}
+
+// renders a duration column as a clock: MM:SS for durations under an
+// hour and HH:MM:SS otherwise.  durations of a day or more keep
+// counting hours (eg, 27:00:00) instead of introducing a days field,
+// so the column stays uniform.  if there's an error, returns the
+// original string
+func renderClock(s string) (string, error) {
+	d, err := parseDuration(s)
+	if err != nil {
+		return s, errors.New("can't parse as a duration: " + s)
+	}
+
+	sign := ""
+	if d < 0 {
+		sign = "-"
+		d = -d
+	}
+	seconds := int64(d / time.Second)
+	hours, minutes := seconds/3600, seconds/60%60
+	seconds %= 60
+	if hours > 0 {
+		return fmt.Sprintf("%s%02d:%02d:%02d", sign, hours, minutes, seconds), nil
+	}
+	return fmt.Sprintf("%s%02d:%02d", sign, minutes, seconds), nil
+}
+
+// defaultBoolGlyphs show true and false values in bool columns
+var defaultBoolGlyphs = [2]string{"✓", "✗"}
+
+// words which mean true or false, in lower case
+var (
+	truthy = map[string]bool{"true": true, "t": true, "yes": true, "y": true, "on": true, "1": true}
+	falsey = map[string]bool{"false": true, "f": true, "no": true, "n": true, "off": true, "0": true}
+)
+
+// renders a boolean like true, yes or 1 (in any case) as glyphs[0] and
+// one like false, no or 0 as glyphs[1].  if there's an error, returns
+// the original string
+func renderBool(s string, glyphs [2]string) (string, error) {
+	word := strings.ToLower(strings.TrimSpace(s))
+	switch {
+	case truthy[word]:
+		return glyphs[0], nil
+	case falsey[word]:
+		return glyphs[1], nil
+	}
+	return s, errors.New("can't parse as a boolean: " + s)
+}
+
+// renders an integer as an English ordinal like 1st, 12th or 23rd.  if
+// there's an error, returns the original string
+func renderOrdinal(s string) (string, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return s, errors.New("can't parse as an integer: " + s)
+	}
+
+	abs := n
+	if abs < 0 {
+		abs = -abs
+	}
+	suffix := "th"
+	if abs%100 < 11 || abs%100 > 13 {
+		switch abs % 10 {
+		case 1:
+			suffix = "st"
+		case 2:
+			suffix = "nd"
+		case 3:
+			suffix = "rd"
+		}
+	}
+	return strconv.Itoa(n) + suffix, nil
+}
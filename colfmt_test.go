@@ -0,0 +1,2603 @@
+package colfmt
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// a command line and its expected output
+type runTest struct {
+	name  string
+	args  []string
+	input string
+	want  string
+}
+
+// runs colfmt with args, returning its output and exit code.  warnings
+// and errors are appended to the output after a line of ---
+func run(args []string, input string) (string, int) {
+	var stdout, stderr bytes.Buffer
+	code := Run(args, strings.NewReader(input), &stdout, &stderr)
+	if stderr.Len() > 0 {
+		return stdout.String() + "---\n" + stderr.String(), code
+	}
+	return stdout.String(), code
+}
+
+func checkRuns(t *testing.T, tests []runTest) {
+	t.Helper()
+	for _, test := range tests {
+		got, _ := run(test.args, test.input)
+		if got != test.want {
+			t.Errorf("%s: colfmt %q\ngot:\n%s\nwant:\n%s", test.name, test.args, got, test.want)
+		}
+	}
+}
+
+func TestWrapColumn(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "words",
+			args:  []string{"-w", "80", "1 9c wrap"},
+			input: "the quick brown fox\tx\n",
+			want:  "the quick  x\nbrown fox   \n",
+		},
+		{
+			name:  "colored word",
+			args:  []string{"-w", "80", "-ansi", "1 5c wrap"},
+			input: "\x1b[31mabcdef\tx\n",
+			want:  "\x1b[31mabcde\x1b[0m  x\n\x1b[31mf\x1b[0m       \n",
+		},
+		{
+			name:  "blank lines use the column's fill",
+			args:  []string{"-w", "80", "1 3c wrap; 2 2c fill:."},
+			input: "ab cd\tx\n",
+			want:  "ab   x.\ncd   ..\n",
+		},
+		{
+			name:  "blank lines of a trimmed last column",
+			args:  []string{"-w", "80", "-trim-trailing", "1 3c wrap; 2 3c right"},
+			input: "ab cd\tx\n",
+			want:  "ab     x\ncd   \n",
+		},
+	})
+}
+
+// a large table of typical cells, for benchmarks
+func benchmarkRows() [][]string {
+	rows := make([][]string, 50000)
+	for i := range rows {
+		rows[i] = []string{
+			"row" + strconv.Itoa(i),
+			strconv.Itoa(i * 7),
+			"some longer descriptive text " + strconv.Itoa(i%13),
+			"2020-01-01",
+			"value",
+		}
+	}
+	return rows
+}
+
+func BenchmarkFormat(b *testing.B) {
+	rows := benchmarkRows()
+	specs, err := ParseColumnSpecs("2 right; 3 20c")
+	if err != nil {
+		b.Fatal(err)
+	}
+	opts := Options{
+		TerminalWidth:   100,
+		FieldSeparator:  "  ",
+		RecordSeparator: "\n",
+		Ellipsis:        "…",
+		Rebalance:       true,
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := Format(ioutil.Discard, rows, specs, opts); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRun(b *testing.B) {
+	var input strings.Builder
+	for _, row := range benchmarkRows() {
+		input.WriteString(strings.Join(row, "\t") + "\n")
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Run([]string{"-w", "100", "2 right; 3 20c"}, strings.NewReader(input.String()), ioutil.Discard, ioutil.Discard)
+	}
+}
+
+func TestStable(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "input order",
+			args:  []string{"-w", "80", "-stable", "-n", "-total", "2 num"},
+			input: "c\t3\na\t1\nb\t2\n",
+			want:  "1  c      3\n2  a      1\n3  b      2\n   total  6\n",
+		},
+		{
+			name:  "explicit sort",
+			args:  []string{"-w", "80", "-stable", "-sort", "1"},
+			input: "c\t3\na\t1\nb\t2\n",
+			want:  "a  1\nb  2\nc  3\n",
+		},
+		{
+			name:  "ties keep input order",
+			args:  []string{"-w", "80", "-stable", "-sort", "1"},
+			input: "b\t1\na\t2\nb\t3\na\t4\n",
+			want:  "a  2\na  4\nb  1\nb  3\n",
+		},
+		{
+			name:  "shuffle",
+			args:  []string{"-w", "80", "-stable", "-shuffle"},
+			input: "a\nb\n",
+			want:  "---\n-shuffle reorders rows, which -stable forbids\n",
+		},
+	})
+}
+
+func TestSpecSources(t *testing.T) {
+	dir, err := ioutil.TempDir("", "colfmt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	specFile := filepath.Join(dir, "spec")
+	if err := ioutil.WriteFile(specFile, []byte("1 right 4c # from the file\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Unsetenv("COLFMT_SPEC")
+	os.Setenv("COLFMT_SPEC", "1 center 6c")
+
+	checkRuns(t, []runTest{
+		{
+			name:  "argument beats file",
+			args:  []string{"-w", "80", "-spec-file", specFile, "1 left 3c"},
+			input: "ab\n",
+			want:  "ab \n",
+		},
+		{
+			name:  "file beats environment",
+			args:  []string{"-w", "80", "-spec-file", specFile},
+			input: "ab\n",
+			want:  "  ab\n",
+		},
+		{
+			name:  "environment",
+			args:  []string{"-w", "80"},
+			input: "ab\n",
+			want:  "  ab  \n",
+		},
+		{
+			name:  "missing file",
+			args:  []string{"-w", "80", "-spec-file", filepath.Join(dir, "missing")},
+			input: "ab\n",
+			want:  "---\nreading spec file: open " + filepath.Join(dir, "missing") + ": no such file or directory\n",
+		},
+	})
+}
+
+func TestQuoteOutput(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "separator in cell",
+			args:  []string{"-w", "80", "-O", " ", "-quote-output"},
+			input: "a b\tc\n\"d\"\te\n",
+			want:  "\"a b\"   c\n\"\"\"d\"\"\" e\n",
+		},
+		{
+			name:  "off by default",
+			args:  []string{"-w", "80", "-O", " "},
+			input: "a b\tc\n",
+			want:  "a b c\n",
+		},
+		{
+			name:  "record separator in cell",
+			args:  []string{"-w", "80", "-csv", "-quote-output"},
+			input: "a,\"b\nc\"\n",
+			want:  "a  \"b\nc\"\n",
+		},
+		{
+			name:  "surrounding whitespace",
+			args:  []string{"-w", "80", "-quote-output"},
+			input: " a\tc\n",
+			want:  "\" a\"  c\n",
+		},
+		{
+			name:  "rendered number",
+			args:  []string{"-w", "80", "-O", ",", "-quote-output", "2 num"},
+			input: "a\t5678\nb\t12\n",
+			want:  "a,\"5,678\"\nb,     12\n",
+		},
+		{
+			name:  "running total and deltas",
+			args:  []string{"-w", "80", "-O", ",", "-quote-output", "-running-total", "2", "2 num; 3 num delta"},
+			input: "a\t1000\t1000\nb\t2000\t500\n",
+			want:  "a,\"1,000\",    ,\"1,000\"\nb,\"2,000\",-500,\"3,000\"\n",
+		},
+		{
+			name:  "rendered number while streaming",
+			args:  []string{"-w", "80", "-O", ",", "-quote-output", "-stream", "-H", "1 6c; 2 num 7c"},
+			input: "p,q\tn\na\t5678\n",
+			want:  "\"p,q\" ,      n\na     ,\"5,678\"\n",
+		},
+	})
+}
+
+func TestProjection(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "reorder",
+			args:  []string{"-w", "80", "-cols", "3,1", "1 right 3c"},
+			input: "a\tb\tc\n",
+			want:  "c    a\n",
+		},
+		{
+			name:  "missing column",
+			args:  []string{"-w", "80", "-cols", "4"},
+			input: "a\tb\tc\n",
+			want:  "---\ncolumn 4 doesn't exist; records have 3 fields\n",
+		},
+		{
+			name:  "running total",
+			args:  []string{"-w", "80", "-cols", "2,1", "-running-total", "2"},
+			input: "a\t1\nb\t2\n",
+			want:  "1  a  1\n2  b  3\n",
+		},
+	})
+}
+
+func TestRunningTotal(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "cumulative",
+			args:  []string{"-w", "80", "-H", "-running-total", "2"},
+			input: "item\tcost\na\t5\nb\t10\nc\t2.5\n",
+			want:  "item  cost  total\na     5       5.0\nb     10     15.0\nc     2.5    17.5\n",
+		},
+		{
+			name:  "num column",
+			args:  []string{"-w", "80", "-running-total", "2", "2 num decimals:1"},
+			input: "a\t1000\nb\t2000\n",
+			want:  "a  1,000.0  1,000.0\nb  2,000.0  3,000.0\n",
+		},
+		{
+			name:  "missing column",
+			args:  []string{"-w", "80", "-running-total", "3"},
+			input: "a\t1\n",
+			want:  "---\nrunning total column 3 doesn't exist\n",
+		},
+	})
+}
+
+func TestDelta(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "increase and decrease",
+			args:  []string{"-w", "80", "2 delta"},
+			input: "a\t10\nb\t15\nc\t12.5\n",
+			want:  "a      \nb  +5.0\nc  -2.5\n",
+		},
+		{
+			name:  "num column",
+			args:  []string{"-w", "80", "2 num delta"},
+			input: "a\t1000\nb\t3500\nc\t500\n",
+			want:  "a        \nb  +2,500\nc  -3,000\n",
+		},
+		{
+			name:  "num decimals",
+			args:  []string{"-w", "80", "2 num decimals:2 delta"},
+			input: "a\t1\nb\t1001\n",
+			want:  "a           \nb  +1,000.00\n",
+		},
+		{
+			name:  "percent column",
+			args:  []string{"-w", "80", "2 percent delta"},
+			input: "a\t0.10\nb\t0.25\n",
+			want:  "---\nparsing column spec: delta can't be used with percent columns\n",
+		},
+		{
+			name:  "duration column",
+			args:  []string{"-w", "80", "2 duration delta"},
+			input: "a\t90\nb\t150\n",
+			want:  "---\nparsing column spec: delta can't be used with duration columns\n",
+		},
+	})
+}
+
+func TestBar(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "scaled to largest",
+			args:  []string{"-w", "80", "2 bar 4c"},
+			input: "a\t2\nb\t4\nc\t1\n",
+			want:  "a  ██  \nb  ████\nc  █   \n",
+		},
+		{
+			name:  "fixed target",
+			args:  []string{"-w", "80", "2 bar:target=8 4c"},
+			input: "a\t2\nb\t9\n",
+			want:  "a  █   \nb  ████\n",
+		},
+		{
+			name:  "beyond target",
+			args:  []string{"-w", "80", "-color", "always", "2 bar:target=4 4c"},
+			input: "a\t2\nb\t6\n",
+			want:  "a  ██  \nb  \x1b[31m████\x1b[0m\n",
+		},
+		{
+			name:  "at target",
+			args:  []string{"-w", "80", "-color", "always", "2 bar:target=4 4c"},
+			input: "a\t4\n",
+			want:  "a  ████\n",
+		},
+		{
+			name:  "invalid target",
+			args:  []string{"-w", "80", "2 bar:target=0"},
+			input: "a\t2\n",
+			want:  "---\nparsing column spec: invalid bar target: bar:target=0\n",
+		},
+		{
+			name:  "streamed with target",
+			args:  []string{"-w", "80", "-stream", "1 1c; 2 bar:target=4 4c"},
+			input: "a\t2\nb\t4\n",
+			want:  "a  ██  \nb  ████\n",
+		},
+		{
+			name:  "streamed without target",
+			args:  []string{"-w", "80", "-stream", "1 1c; 2 bar 4c"},
+			input: "a\t2\nb\t4\n",
+			want:  "---\n-stream can't scale bars to their largest value; use bar:target=N\n",
+		},
+		{
+			name:  "beyond the record",
+			args:  []string{"-w", "0", "5 bar"},
+			input: "a\tb\tc\n",
+			want:  "a  b  c\n",
+		},
+	})
+}
+
+func TestTrimTrailing(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "last column unpadded",
+			args:  []string{"-w", "80", "-trim-trailing"},
+			input: "a\tb\nlong\tlonger\n",
+			want:  "a     b\nlong  longer\n",
+		},
+		{
+			name:  "inner padding kept",
+			args:  []string{"-w", "80", "-trim-trailing"},
+			input: "a\t\tc\nlong\tx\t\n",
+			want:  "a        c\nlong  x  \n",
+		},
+		{
+			name:  "right aligned last column",
+			args:  []string{"-w", "80", "-trim-trailing", "2 right"},
+			input: "a\t1\nb\t100\n",
+			want:  "a    1\nb  100\n",
+		},
+		{
+			name:  "colored last column",
+			args:  []string{"-w", "80", "-ansi", "-trim-trailing"},
+			input: "a\t\x1b[31mred\x1b[0m\nlonger\tx\n",
+			want:  "a       \x1b[31mred\x1b[0m\nlonger  x\n",
+		},
+		{
+			name:  "wrapped last column",
+			args:  []string{"-w", "80", "-trim-trailing", "1 3c wrap"},
+			input: "ab cd\tx\n",
+			want:  "ab   x\ncd   \n",
+		},
+	})
+}
+
+func TestEnum(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "mapped and unmapped values",
+			args:  []string{"-w", "80", "1 enum:DEBUG=DBG,INFO=INF"},
+			input: "DEBUG\tx\nINFO\ty\nWARN\tz\n",
+			want:  "DBG  x\nINF  y\nWAR  z\n",
+		},
+		{
+			name:  "log levels",
+			args:  []string{"-w", "80", "1 enum:DEBUG=DBG,INFO=INF,WARN=WRN,ERROR=ERR"},
+			input: "DEBUG\tx\nINFO\ty\nWARN\tz\nERROR\tw\nTRACE\tv\nX\tu\n",
+			want:  "DBG  x\nINF  y\nWRN  z\nERR  w\nTRA  v\nX    u\n",
+		},
+		{
+			name:  "colored symbols",
+			args:  []string{"-w", "80", "-color", "always", "1 enum:INFO=INF,WARN=WRN:yellow,ERROR=ERR:red"},
+			input: "INFO\tx\nWARN\ty\nERROR\tz\n",
+			want:  "INF  x\n\x1b[33mWRN\x1b[0m  y\n\x1b[31mERR\x1b[0m  z\n",
+		},
+		{
+			name:  "colored symbols without color",
+			args:  []string{"-w", "80", "-color", "never", "1 enum:ERROR=ERR:red"},
+			input: "ERROR\tz\n",
+			want:  "ERR  z\n",
+		},
+		{
+			name:  "unknown color",
+			args:  []string{"-w", "80", "1 enum:ERROR=ERR:mauve"},
+			input: "ERROR\n",
+			want:  "---\nparsing column spec: unknown color: mauve\n",
+		},
+	})
+}
+
+func TestSpecBeyondRecord(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "right",
+			args:  []string{"-w", "80", "5 right"},
+			input: "a\tb\tc\n",
+			want:  "a  b  c\n",
+		},
+		{
+			name:  "num",
+			args:  []string{"-w", "80", "5 num"},
+			input: "a\tb\tc\n",
+			want:  "a  b  c\n",
+		},
+		{
+			name:  "trim",
+			args:  []string{"-w", "80", "5 trim"},
+			input: "a\tb\tc\n",
+			want:  "a  b  c\n",
+		},
+		{
+			name:  "wrap",
+			args:  []string{"-w", "80", "5 wrap"},
+			input: "a\tb\tc\n",
+			want:  "a  b  c\n",
+		},
+		{
+			name:  "delta",
+			args:  []string{"-w", "80", "5 delta"},
+			input: "a\tb\tc\n",
+			want:  "a  b  c\n",
+		},
+		{
+			name:  "1x",
+			args:  []string{"-w", "80", "5 1x"},
+			input: "a\tb\tc\n",
+			want:  "a  b  c\n",
+		},
+		{
+			name:  "empty:-",
+			args:  []string{"-w", "80", "5 empty:-"},
+			input: "a\tb\tc\n",
+			want:  "a  b  c\n",
+		},
+		{
+			name:  "total:sum",
+			args:  []string{"-w", "80", "5 total:sum"},
+			input: "a\tb\tc\n",
+			want:  "a      b  c\ntotal      \n",
+		},
+	})
+}
+
+func TestColumnSpecZeroValue(t *testing.T) {
+	rows := [][]string{{"a", "1.5"}, {"bb", "2"}}
+	opts := Options{FieldSeparator: "  ", RecordSeparator: "\n"}
+	tests := []struct {
+		name string
+		spec *ColumnSpec
+		want string
+	}{
+		{"NewColumnSpec", NewColumnSpec(), "a   1.5\nbb  2  \n"},
+		{"literal", &ColumnSpec{WidthMax: -1, Decimals: -1}, "a   1.5\nbb  2  \n"},
+		{"zero value hides", &ColumnSpec{}, "a \nbb\n"},
+	}
+	for _, test := range tests {
+		var out bytes.Buffer
+		specs := map[int]*ColumnSpec{1: test.spec}
+		if err := Format(&out, rows, specs, opts); err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		if got := out.String(); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestParseColumnSpecWidths(t *testing.T) {
+	tests := []struct {
+		spec     string
+		min, max int
+		err      string
+	}{
+		{spec: "1 7c", min: 7, max: 7},
+		{spec: "1 0c", min: 0, max: 0},
+		{spec: "1 *", min: -1, max: -1},
+		{spec: "1 3c-9c", min: 3, max: 9},
+		{spec: "1 3c-*", min: 3, max: -1},
+		{spec: "1 5c-3c", err: "invalid width range: min 5 greater than max 3"},
+		{spec: "1 -3c", err: "negative width: -3c"},
+		{spec: "1 12xc", err: "invalid width: 12x"},
+		{spec: "1 3c-9xc", err: "invalid width: 9x"},
+	}
+	for _, test := range tests {
+		specs, err := ParseColumnSpecs(test.spec)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("%q: got error %v, want %q", test.spec, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %s", test.spec, err)
+			continue
+		}
+		spec := specs[0]
+		if spec.WidthMin != test.min || spec.WidthMax != test.max {
+			t.Errorf("%q: got widths %d-%d, want %d-%d", test.spec, spec.WidthMin, spec.WidthMax, test.min, test.max)
+		}
+	}
+}
+
+func TestConcurrentRuns(t *testing.T) {
+	tests := []runTest{
+		{
+			name:  "year",
+			args:  []string{"-w", "80", "-date-layout", "2006", "1 date"},
+			input: "2020-01-02T03:04:05Z\n",
+			want:  "2020\n",
+		},
+		{
+			name:  "default layout",
+			args:  []string{"-w", "80", "1 date"},
+			input: "2020-01-02T03:04:05Z\n",
+			want:  "2020-01-02 03:04\n",
+		},
+		{
+			name:  "warning",
+			args:  []string{"-w", "80", "1 num"},
+			input: "x\n",
+			want:  "x\n---\nUnexpected number format: \"x\"\n",
+		},
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		test := tests[i%len(tests)]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if got, _ := run(test.args, test.input); got != test.want {
+				t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestRenderRowsMessages(t *testing.T) {
+	specs, err := ParseColumnSpecs("1 num")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var messages bytes.Buffer
+	RenderRows([][]string{{"x"}}, specs, Options{Messages: &messages})
+	if got, want := messages.String(), "Unexpected number format: \"x\"\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// without a destination, messages are discarded
+	RenderRows([][]string{{"x"}}, specs, Options{})
+}
+
+func TestClock(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "seconds",
+			args:  []string{"-w", "80", "1 clock"},
+			input: "0\n59\n3600\n90061\n-75\n",
+			want:  "00:00   \n00:59   \n01:00:00\n25:01:01\n-01:15  \n",
+		},
+		{
+			name:  "go durations",
+			args:  []string{"-w", "80", "1 clock"},
+			input: "45s\n1h2m3s\n",
+			want:  "00:45   \n01:02:03\n",
+		},
+		{
+			name:  "unparsable",
+			args:  []string{"-w", "80", "1 clock"},
+			input: "x\n",
+			want:  "x\n---\nUnexpected duration format: \"x\"\n",
+		},
+	})
+}
+
+func TestAlignWith(t *testing.T) {
+	dir, err := ioutil.TempDir("", "colfmt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	reference := filepath.Join(dir, "reference")
+	if err := ioutil.WriteFile(reference, []byte("reference header\th2\nmid cell\tbb\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	checkRuns(t, []runTest{
+		{
+			name:  "widths from reference",
+			args:  []string{"-w", "80", "-align-with", reference},
+			input: "a\tb\n",
+			want:  "a                 b \n",
+		},
+		{
+			name:  "reference header skipped",
+			args:  []string{"-w", "80", "-H", "-align-with", reference},
+			input: "x\ty\nab\tc\n",
+			want:  "x         y \nab        c \n",
+		},
+		{
+			name:  "missing reference",
+			args:  []string{"-w", "80", "-align-with", filepath.Join(dir, "missing")},
+			input: "a\tb\n",
+			want:  "---\nopening reference file: open " + filepath.Join(dir, "missing") + ": no such file or directory\n",
+		},
+		{
+			name:  "with transpose",
+			args:  []string{"-w", "80", "-transpose", "-align-with", reference},
+			input: "a\tb\n",
+			want:  "---\ncan't use both -transpose and -align-with\n",
+		},
+	})
+}
+
+func TestOrdinal(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "suffixes",
+			args:  []string{"-w", "80", "1 ordinal"},
+			input: "1\n2\n3\n4\n11\n12\n13\n21\n101\n102\n111\n",
+			want:  "1st  \n2nd  \n3rd  \n4th  \n11th \n12th \n13th \n21st \n101st\n102nd\n111th\n",
+		},
+		{
+			name:  "unparsable",
+			args:  []string{"-w", "80", "1 ordinal"},
+			input: "x\n",
+			want:  "x\n---\nUnexpected integer format: \"x\"\n",
+		},
+	})
+}
+
+func TestOverflow(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "marked",
+			args:  []string{"-w", "10", "-mark-overflow", "1 8c; 2 8c"},
+			input: "abc\tdef\n",
+			want:  "abc      »\n",
+		},
+		{
+			name:  "clipped",
+			args:  []string{"-w", "10", "-clip", "1 8c; 2 8c"},
+			input: "abc\tdef\n",
+			want:  "abc       \n",
+		},
+		{
+			name:  "fits",
+			args:  []string{"-w", "20", "-mark-overflow", "1 8c; 2 8c"},
+			input: "abc\tdef\n",
+			want:  "abc       def     \n",
+		},
+	})
+}
+
+func TestPagerMode(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "wrap shrinks columns",
+			args:  []string{"-w", "10", "-pager-mode", "wrap", "1 2c-*; 2 2c-*"},
+			input: "abcdefgh\tijklmnop\n",
+			want:  "abc…  ijk…\n",
+		},
+		{
+			name:  "chop keeps widths",
+			args:  []string{"-w", "10", "-pager-mode", "chop", "1 2c-*; 2 2c-*"},
+			input: "abcdefgh\tijklmnop\n",
+			want:  "abcdefgh »\n",
+		},
+		{
+			name:  "unknown",
+			args:  []string{"-w", "10", "-pager-mode", "page"},
+			input: "a\n",
+			want:  "---\nunknown -pager-mode: page\n",
+		},
+	})
+}
+
+func TestSpecBlock(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "spec before data",
+			args:  []string{"-w", "80", "-spec-block"},
+			input: "1 right 4c\n---\nab\tc\n",
+			want:  "  ab  c\n",
+		},
+		{
+			name:  "without a sentinel",
+			args:  []string{"-w", "80", "-spec-block"},
+			input: "ab\tc\n",
+			want:  "ab  c\n",
+		},
+		{
+			name:  "with a spec file",
+			args:  []string{"-w", "80", "-spec-block", "-spec-file", "spec"},
+			input: "a\n",
+			want:  "---\ncan't use both -spec-file and -spec-block\n",
+		},
+	})
+}
+
+func TestGroup(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "phone number",
+			args:  []string{"-w", "80", "1 group:3,3,4"},
+			input: "5551234567\n",
+			want:  "555-123-4567\n",
+		},
+		{
+			name:  "separator",
+			args:  []string{"-w", "80", "1 group:3,3,4/."},
+			input: "5551234567\n",
+			want:  "555.123.4567\n",
+		},
+		{
+			name:  "repeated size",
+			args:  []string{"-w", "80", "1 group:4"},
+			input: "12345678\n",
+			want:  "1234-5678\n",
+		},
+		{
+			name:  "MAC address",
+			args:  []string{"-w", "80", "1 group:2/:"},
+			input: "001a2b3c4d5e\n",
+			want:  "00:1a:2b:3c:4d:5e\n",
+		},
+		{
+			name:  "wrong length",
+			args:  []string{"-w", "80", "1 group:3,3,4"},
+			input: "12345\n",
+			want:  "12345\n---\nUnexpected length for grouping: \"12345\"\n",
+		},
+		{
+			name:  "invalid size",
+			args:  []string{"-w", "80", "1 group:x"},
+			input: "1\n",
+			want:  "---\nparsing column spec: invalid group size: x\n",
+		},
+	})
+}
+
+func TestShuffle(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "seeded",
+			args:  []string{"-w", "80", "-shuffle", "-seed", "1"},
+			input: "a\nb\nc\nd\n",
+			want:  "a\nb\nd\nc\n",
+		},
+		{
+			name:  "header stays on top",
+			args:  []string{"-w", "80", "-H", "-shuffle", "-seed", "2"},
+			input: "h\na\nb\nc\nd\n",
+			want:  "h\nb\nc\nd\na\n",
+		},
+		{
+			name:  "with sort",
+			args:  []string{"-w", "80", "-shuffle", "-sort", "1"},
+			input: "a\n",
+			want:  "---\ncan't use both -sort and -shuffle\n",
+		},
+	})
+}
+
+func TestMaxFields(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "last field keeps separators",
+			args:  []string{"-w", "80", "-max-fields", "2", "-F", ","},
+			input: "a,b,c\nx,y\n",
+			want:  "a  b,c\nx  y  \n",
+		},
+		{
+			name:  "tabs in the last field",
+			args:  []string{"-w", "80", "-max-fields", "2"},
+			input: "a\tb\tc\n",
+			want:  "a  b c\n",
+		},
+		{
+			name:  "message with tabs",
+			args:  []string{"-w", "80", "-max-fields", "3"},
+			input: "a\tb\tmsg\twith\ttabs\n",
+			want:  "a  b  msg with tabs\n",
+		},
+		{
+			name:  "message with tabs kept",
+			args:  []string{"-w", "80", "-max-fields", "3", "-tabs", "keep"},
+			input: "a\tb\tmsg\twith\ttabs\n",
+			want:  "a  b  msg\twith\ttabs\n",
+		},
+		{
+			name:  "zero",
+			args:  []string{"-w", "80", "-max-fields", "0"},
+			input: "a\n",
+			want:  "---\n-max-fields must be positive: 0\n",
+		},
+	})
+}
+
+func TestIP(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "aligned octets",
+			args:  []string{"-w", "80", "1 ip"},
+			input: "10.0.0.1\n192.168.100.20\n",
+			want:  " 10.  0.  0.  1\n192.168.100. 20\n",
+		},
+		{
+			name:  "zero padded",
+			args:  []string{"-w", "80", "1 ip:zero"},
+			input: "10.0.0.1\n192.168.100.20\n",
+			want:  "010.000.000.001\n192.168.100.020\n",
+		},
+		{
+			name:  "not IPv4",
+			args:  []string{"-w", "80", "1 ip"},
+			input: "::1\n",
+			want:  "::1\n---\nUnexpected IP address format: \"::1\"\n",
+		},
+	})
+}
+
+func TestMerge(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "joined by a space",
+			args:  []string{"-w", "80", "-merge", "2-3"},
+			input: "a\tb\tc\td\n",
+			want:  "a  b c  d\n",
+		},
+		{
+			name:  "joiner",
+			args:  []string{"-w", "80", "-merge", "2-3:/"},
+			input: "a\tb\tc\td\n",
+			want:  "a  b/c  d\n",
+		},
+		{
+			name:  "three columns",
+			args:  []string{"-w", "80", "-merge", "2-4"},
+			input: "1\tJohn\tQ\tSmith\n2\tJane\t\tDoe\n",
+			want:  "1  John Q Smith\n2  Jane Doe    \n",
+		},
+		{
+			name:  "missing column",
+			args:  []string{"-w", "80", "-merge", "2-5"},
+			input: "a\tb\tc\n",
+			want:  "---\nmerged column 5 doesn't exist\n",
+		},
+	})
+}
+
+func TestTabs(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "replaced",
+			args:  []string{"-w", "80", "-F", ",", "-tabs", "replace:2"},
+			input: "a\tb,c\n",
+			want:  "a  b  c\n",
+		},
+		{
+			name:  "expanded",
+			args:  []string{"-w", "80", "-F", ",", "-tabs", "expand:4"},
+			input: "a\tb,c\n",
+			want:  "a   b  c\n",
+		},
+		{
+			name:  "expanded to default stops",
+			args:  []string{"-w", "80", "-F", ",", "-tabs", "expand"},
+			input: "ab\tc,d\n",
+			want:  "ab      c  d\n",
+		},
+		{
+			name:  "kept",
+			args:  []string{"-w", "80", "-F", ",", "-tabs", "keep"},
+			input: "a\tb,c\n",
+			want:  "a\tb  c\n",
+		},
+		{
+			name:  "error",
+			args:  []string{"-w", "80", "-F", ",", "-tabs", "error"},
+			input: "x\ny\tz,c\n",
+			want:  "---\nrecord 2, field 1 contains a tab\n",
+		},
+		{
+			name:  "unknown mode",
+			args:  []string{"-w", "80", "-tabs", "bogus"},
+			input: "a\n",
+			want:  "---\nparsing -tabs: unknown mode: bogus\n",
+		},
+	})
+}
+
+func TestPaginate(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "pages",
+			args:  []string{"-w", "12", "-paginate"},
+			input: "aaaa\tbbbb\tcccc\n1\t2\t3\n",
+			want:  "aaaa  bbbb\n1     2   \n\ncccc\n3   \n",
+		},
+		{
+			name:  "key column",
+			args:  []string{"-w", "12", "-paginate", "-key-column", "1"},
+			input: "aaaa\tbbbb\tcccc\n1\t2\t3\n",
+			want:  "aaaa  bbbb\n1     2   \n\naaaa  cccc\n1     3   \n",
+		},
+	})
+}
+
+func TestEmptyMessage(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "no input",
+			args:  []string{"-w", "80", "-empty-message", "(none)"},
+			input: "",
+			want:  "(none)\n",
+		},
+		{
+			name:  "no input without a message",
+			args:  []string{"-w", "80"},
+			input: "",
+			want:  "",
+		},
+		{
+			name:  "only a header",
+			args:  []string{"-w", "80", "-H", "-empty-message", "(none)"},
+			input: "name\tage\n",
+			want:  "name  age\n(none)\n",
+		},
+		{
+			name:  "streamed",
+			args:  []string{"-w", "80", "-stream", "-empty-message", "(none)", "1 4c"},
+			input: "",
+			want:  "(none)\n",
+		},
+		{
+			name:  "rows",
+			args:  []string{"-w", "80", "-empty-message", "(none)"},
+			input: "a\n",
+			want:  "a\n",
+		},
+	})
+}
+
+func TestScale(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "multiplied",
+			args:  []string{"-w", "80", "1 scale:1000"},
+			input: "1.5\n2\n",
+			want:  "1500\n2000\n",
+		},
+		{
+			name:  "with decimals",
+			args:  []string{"-w", "80", "1 scale:0.001 decimals:1"},
+			input: "1500\n260\n",
+			want:  "1.5\n0.3\n",
+		},
+		{
+			name:  "milliseconds to seconds",
+			args:  []string{"-w", "80", "1 scale:0.001 decimals:2"},
+			input: "1500\n260\n1\n",
+			want:  "1.50\n0.26\n0.00\n",
+		},
+		{
+			name:  "then grouped",
+			args:  []string{"-w", "80", "1 scale:1000 num"},
+			input: "1.5\n2\n",
+			want:  "1,500\n2,000\n",
+		},
+		{
+			name:  "unparsable",
+			args:  []string{"-w", "80", "1 scale:1000"},
+			input: "x\n",
+			want:  "x\n---\nUnexpected number format: \"x\"\n",
+		},
+		{
+			name:  "invalid scale",
+			args:  []string{"-w", "80", "1 scale:x"},
+			input: "1\n",
+			want:  "---\nparsing column spec: invalid scale: scale:x\n",
+		},
+	})
+}
+
+func TestMixedAges(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "timestamps and relative ages",
+			args:  []string{"-w", "80", "-now", "2020-06-15T12:00:00Z", "1 age"},
+			input: "2020-06-15T11:59:30Z\n5m\n1592215200\n2020-06-15T09:00:00Z\nin 3d\n",
+			want:  "  30s\n   5m\n   2h\n   3h\nin 3d\n",
+		},
+		{
+			name:  "unparsable",
+			args:  []string{"-w", "80", "-now", "2020-06-15T12:00:00Z", "1 age"},
+			input: "garbage\n",
+			want:  "garbage\n---\nUnexpected date format: \"garbage\"\n",
+		},
+	})
+}
+
+func TestFutureAges(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "future timestamps",
+			args:  []string{"-w", "80", "-now", "2020-06-15T12:00:00Z", "1 age"},
+			input: "2020-06-15T12:05:00Z\n2020-06-18T12:00:00Z\n2020-06-15T11:00:00Z\n",
+			want:  "in 5m\nin 3d\n  60m\n",
+		},
+	})
+}
+
+func TestEpochAges(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "seconds and milliseconds",
+			args:  []string{"-w", "80", "-now", "2020-06-15T12:00:00Z", "1 age"},
+			input: "1592215200\n1592222340000\n",
+			want:  " 2h\n60s\n",
+		},
+		{
+			name:  "implausible epoch",
+			args:  []string{"-w", "80", "-now", "2020-06-15T12:00:00Z", "1 age"},
+			input: "12345\n",
+			want:  "12345\n---\nUnexpected date format: \"12345\"\n",
+		},
+	})
+}
+
+func TestAgeWeeks(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "weeks between 14 and 60 days",
+			args:  []string{"-w", "80", "-now", "2020-06-15T12:00:00Z", "1 age"},
+			input: "2020-06-05T12:00:00Z\n2020-05-25T12:00:00Z\n2020-04-01T12:00:00Z\n",
+			want:  "10d\n 3w\n 2M\n",
+		},
+		{
+			name:  "cutovers",
+			args:  []string{"-w", "80", "-now", "2020-06-15T12:00:00Z", "1 age"},
+			input: "2020-06-02T12:00:00Z\n2020-06-01T12:00:00Z\n2020-04-17T12:00:00Z\n2020-04-16T12:00:00Z\n",
+			want:  "13d\n 2w\n 8w\n 2M\n",
+		},
+		{
+			name:  "without weeks",
+			args:  []string{"-w", "80", "-now", "2020-06-15T12:00:00Z", "-age-weeks=false", "1 age"},
+			input: "2020-05-25T12:00:00Z\n",
+			want:  "21d\n",
+		},
+	})
+}
+
+func TestNow(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "timestamp",
+			args:  []string{"-w", "80", "-now", "2020-06-15T12:00:00Z", "1 age"},
+			input: "2020-06-15T11:00:00Z\n",
+			want:  "60m\n",
+		},
+		{
+			name:  "epoch seconds",
+			args:  []string{"-w", "80", "-now", "1592222400", "1 age"},
+			input: "2020-06-15T10:00:00Z\n",
+			want:  "2h\n",
+		},
+		{
+			name:  "far past shows the year",
+			args:  []string{"-w", "80", "-now", "2020-06-15T12:00:00Z", "1 age"},
+			input: "2018-01-01T00:00:00Z\n",
+			want:  "2018\n",
+		},
+		{
+			name:  "unparsable",
+			args:  []string{"-w", "80", "-now", "yesterday", "1 age"},
+			input: "x\n",
+			want:  "---\nparsing -now: can't parse as a time: yesterday\n",
+		},
+	})
+}
+
+func TestRenderRowsNow(t *testing.T) {
+	specs, err := ParseColumnSpecs("1 age")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := [][]string{{"2020-06-15T11:59:00Z"}}
+	opts := Options{Now: time.Date(2020, 6, 15, 12, 0, 0, 0, time.UTC)}
+	RenderRows(rows, specs, opts)
+	if got, want := rows[0][0], "60s"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestHeat(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "bands",
+			args:  []string{"-w", "80", "-color", "always", "1 heat:50=yellow,90=red"},
+			input: "10\n60\n95\nx\n",
+			want:  "10\n\x1b[33m60\x1b[0m\n\x1b[31m95\x1b[0m\nx \n",
+		},
+		{
+			name:  "without color",
+			args:  []string{"-w", "80", "-color", "never", "1 heat:50=yellow,90=red"},
+			input: "95\n",
+			want:  "95\n",
+		},
+		{
+			name:  "unknown color",
+			args:  []string{"-w", "80", "1 heat:50=mauve"},
+			input: "1\n",
+			want:  "---\nparsing column spec: unknown color: mauve\n",
+		},
+		{
+			name:  "invalid threshold",
+			args:  []string{"-w", "80", "1 heat:x=red"},
+			input: "1\n",
+			want:  "---\nparsing column spec: invalid heat threshold: x\n",
+		},
+	})
+}
+
+func TestWeights(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "equal weights",
+			args:  []string{"-w", "20", "1 1x; 2 1x"},
+			input: "aaaaaaaaaaaaaaa\tbbbbbbbbbbbbbbb\n",
+			want:  "aaaaaaaa…  bbbbbbbb…\n",
+		},
+		{
+			name:  "heavier column shrinks more",
+			args:  []string{"-w", "20", "1 2x; 2 1x"},
+			input: "aaaaaaaaaaaaaaa\tbbbbbbbbbbbbbbb\n",
+			want:  "aaaaa…  bbbbbbbbbbb…\n",
+		},
+		{
+			name:  "equal weights fill",
+			args:  []string{"-w", "20", "-fill", "1 1x; 2 1x"},
+			input: "aa\tbb\n",
+			want:  "aa         bb       \n",
+		},
+		{
+			name:  "heavier column grows more",
+			args:  []string{"-w", "20", "-fill", "1 2x; 2 1x"},
+			input: "aa\tbb\n",
+			want:  "aa            bb    \n",
+		},
+		{
+			name:  "equal weights shrink proportionally",
+			args:  []string{"-w", "20", "-shrink", "proportional", "1 1x; 2 1x"},
+			input: "aaaaaaaaaaaaaaaaaaaaa\tbbbbbbbbbbb\n",
+			want:  "aaaaaaaaaaa…  bbbbb…\n",
+		},
+		{
+			name:  "heavier column shrinks proportionally more",
+			args:  []string{"-w", "20", "-shrink", "proportional", "1 2x; 2 1x"},
+			input: "aaaaaaaaaaaaaaaaaaaaa\tbbbbbbbbbbb\n",
+			want:  "aaaaaaaaa…  bbbbbbb…\n",
+		},
+		{
+			name:  "zero weight",
+			args:  []string{"-w", "80", "1 0x"},
+			input: "a\n",
+			want:  "---\nparsing column spec: invalid column weight: 0x\n",
+		},
+	})
+}
+
+func TestTrim(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "every column",
+			args:  []string{"-w", "80", "-trim"},
+			input: "  a  \t b\n",
+			want:  "a  b\n",
+		},
+		{
+			name:  "one column",
+			args:  []string{"-w", "80", "1 trim"},
+			input: "  a  \t b\n",
+			want:  "a   b\n",
+		},
+		{
+			name:  "only whitespace",
+			args:  []string{"-w", "80", "-trim", "-empty", "-"},
+			input: "   \tb\n",
+			want:  "-  b\n",
+		},
+	})
+}
+
+func TestUnknownTerminalWidth(t *testing.T) {
+	defer os.Setenv("COLUMNS", os.Getenv("COLUMNS"))
+	os.Unsetenv("COLUMNS")
+
+	checkRuns(t, []runTest{
+		{
+			name:  "zero width",
+			args:  []string{"-w", "0", "1 10c-*"},
+			input: "a long cell that is wide\tb\n",
+			want:  "a long cell that is wide  b\n",
+		},
+		{
+			name:  "unknown width",
+			args:  []string{"1 10c-*"},
+			input: "a long cell that is wide\tb\n",
+			want:  "a long cell that is wide  b\n",
+		},
+		{
+			name:  "clipped to unknown width",
+			args:  []string{"-clip", "1 10c-*"},
+			input: "a long cell that is wide\tb\n",
+			want:  "a long cell that is wide  b\n",
+		},
+	})
+}
+
+func TestCRLF(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "tab separated",
+			args:  []string{"-w", "80"},
+			input: "a\tb\r\nc\td\r\n",
+			want:  "a  b\nc  d\n",
+		},
+		{
+			name:  "csv",
+			args:  []string{"-w", "80", "-csv"},
+			input: "a,b\r\nc,d\r\n",
+			want:  "a  b\nc  d\n",
+		},
+		{
+			name:  "streamed",
+			args:  []string{"-w", "80", "-stream", "1 1c; 2 1c"},
+			input: "a\tb\r\nc\td\r\n",
+			want:  "a  b\nc  d\n",
+		},
+	})
+}
+
+func TestHeader(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "never truncated",
+			args:  []string{"-w", "80", "-H", "1 4c-4c"},
+			input: "longname\tn\nabcdefghij\t1\n",
+			want:  "longname  n\nabcdefg…  1\n",
+		},
+		{
+			name:  "streamed to fixed widths",
+			args:  []string{"-w", "80", "-H", "-stream", "1 4c; 2 1c"},
+			input: "longname\tn\nabcdefghij\t1\n",
+			want:  "lon…  n\nabc…  1\n",
+		},
+	})
+}
+
+func TestMarkdown(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "synthesized header",
+			args:  []string{"-w", "80", "-output", "markdown"},
+			input: "a|b\t1\n",
+			want:  "| c1 | c2 |\n| --- | --- |\n| a\\|b | 1 |\n",
+		},
+		{
+			name:  "alignment hints",
+			args:  []string{"-w", "80", "-H", "-output", "markdown", "1 left; 2 right; 3 center"},
+			input: "name\tn\tx\nbob\t2\ty\n",
+			want:  "| name | n | x |\n| :--- | ---: | :---: |\n| bob | 2 | y |\n",
+		},
+		{
+			name:  "spec without alignment",
+			args:  []string{"-w", "80", "-output", "markdown", "1 40c; 2 num"},
+			input: "a\t1\tx\n",
+			want:  "| c1 | c2 | c3 |\n| --- | ---: | --- |\n| a | 1 | x |\n",
+		},
+	})
+}
+
+func TestNulRecords(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "terminated records",
+			args:  []string{"-w", "80", "-0"},
+			input: "a\tbb\x00ccc\td\x00",
+			want:  "a    bb\x00ccc  d \x00",
+		},
+		{
+			name:  "unterminated last record",
+			args:  []string{"-w", "80", "-0"},
+			input: "a\t\x00c\td",
+			want:  "a   \x00c  d\x00",
+		},
+		{
+			name:  "consecutive NULs",
+			args:  []string{"-w", "80", "-0"},
+			input: "a\tb\x00\x00c\td\x00",
+			want:  "a  b\x00c  d\x00",
+		},
+	})
+}
+
+func TestParseColumnSpecErrors(t *testing.T) {
+	tests := []struct {
+		spec string
+		err  string
+	}{
+		{"1 enum:a", "invalid enum mapping: a"},
+		{"1 group:0", "invalid group size: 0"},
+		{"1 heat:5", "invalid heat band: 5"},
+		{"1 decimals:-1", "invalid decimals: decimals:-1"},
+		{"1 fill:ab", "fill must be a single character, one column wide: fill:ab"},
+		{"1 fg:mauve", "unknown color: mauve"},
+		{"1 total:median", "unknown total: median"},
+		{"1 101%", "invalid width percentage: 101%"},
+		{"1 bogus", `unexpected token "bogus" at position 2 (byte 2)`},
+		{"name:x 4c", "columns chosen by name, like name:age, need a header"},
+	}
+	for _, test := range tests {
+		_, err := ParseColumnSpecs(test.spec)
+		if err == nil || err.Error() != test.err {
+			t.Errorf("%q: got error %v, want %q", test.spec, err, test.err)
+		}
+	}
+}
+
+func TestCenter(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "split evenly",
+			args:  []string{"-w", "80", "1 center 6c; 2 1c"},
+			input: "ab\tx\nabcdef\ty\n",
+			want:  "  ab    x\nabcdef  y\n",
+		},
+		{
+			name:  "extra space on the right",
+			args:  []string{"-w", "80", "1 center 5c; 2 1c"},
+			input: "ab\tx\n",
+			want:  " ab    x\n",
+		},
+		{
+			name:  "exactly the width",
+			args:  []string{"-w", "80", "1 center 3c-3c; 2 1c"},
+			input: "abc\tx\n",
+			want:  "abc  x\n",
+		},
+		{
+			name:  "wider than the width",
+			args:  []string{"-w", "80", "1 center 3c-3c; 2 1c"},
+			input: "abcdef\tx\n",
+			want:  "ab…  x\n",
+		},
+	})
+}
+
+func TestEllipsis(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "default",
+			args:  []string{"-w", "80", "1 4c-4c; 2 1c"},
+			input: "abcdefgh\tx\n",
+			want:  "abc…  x\n",
+		},
+		{
+			name:  "custom",
+			args:  []string{"-w", "80", "-e", "...", "1 5c-5c; 2 1c"},
+			input: "abcdefgh\tx\n",
+			want:  "ab...  x\n",
+		},
+		{
+			name:  "long form",
+			args:  []string{"-w", "80", "-ellipsis", "~", "1 4c-4c; 2 1c"},
+			input: "abcdefgh\tx\n",
+			want:  "abc~  x\n",
+		},
+		{
+			name:  "indicator wider than the column",
+			args:  []string{"-w", "80", "-e", "...", "1 2c-2c; 2 1c"},
+			input: "abcdefgh\tx\n",
+			want:  "ab  x\n",
+		},
+		{
+			name:  "without an indicator",
+			args:  []string{"-w", "80", "-e", "", "1 4c-4c; 2 1c"},
+			input: "abcdefgh\tx\n",
+			want:  "abcd  x\n",
+		},
+	})
+}
+
+func TestNum(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "grouped",
+			args:  []string{"-w", "80", "1 num"},
+			input: "1234567\n12\n-98765\n",
+			want:  "1,234,567\n       12\n  -98,765\n",
+		},
+		{
+			name:  "decimals",
+			args:  []string{"-w", "80", "1 num"},
+			input: "1234.5\n",
+			want:  "1,234.5\n",
+		},
+		{
+			name:  "unparsable",
+			args:  []string{"-w", "80", "1 num"},
+			input: "abc\n",
+			want:  "abc\n---\nUnexpected number format: \"abc\"\n",
+		},
+	})
+}
+
+func TestDuration(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "go durations",
+			args:  []string{"-w", "80", "1 duration"},
+			input: "1h30m\n90s\n50h\n",
+			want:  "1h30m\n1m30s\n 2d2h\n",
+		},
+		{
+			name:  "seconds",
+			args:  []string{"-w", "80", "1 duration"},
+			input: "90\n5400\n183600\n",
+			want:  "1m30s\n1h30m\n 2d3h\n",
+		},
+		{
+			name:  "unparsable",
+			args:  []string{"-w", "80", "1 duration"},
+			input: "soon\n",
+			want:  "soon\n---\nUnexpected duration format: \"soon\"\n",
+		},
+	})
+}
+
+func TestDate(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "canonical layout",
+			args:  []string{"-w", "80", "1 date"},
+			input: "2020-06-15T11:59:30Z\nMon Jun 15 09:00:00 2020\n",
+			want:  "2020-06-15 11:59\n2020-06-15 09:00\n",
+		},
+		{
+			name:  "custom layout",
+			args:  []string{"-w", "80", "-date-layout", "Jan 2, 2006", "1 date"},
+			input: "2020-06-15T11:59:30Z\n",
+			want:  "Jun 15, 2020\n",
+		},
+		{
+			name:  "unparsable",
+			args:  []string{"-w", "80", "1 date"},
+			input: "someday\n",
+			want:  "someday\n---\nUnexpected date format: \"someday\"\n",
+		},
+	})
+}
+
+func TestAgeUnits(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "minutes up to 180",
+			args:  []string{"-w", "80", "-now", "2020-06-15T12:00:00Z", "-age-units", "s:90,m:180,h:24", "1 age"},
+			input: "2020-06-15T10:00:00Z\n2020-06-15T08:00:00Z\n",
+			want:  "120m\n  4h\n",
+		},
+		{
+			name:  "year fallback",
+			args:  []string{"-w", "80", "-now", "2020-06-15T12:00:00Z", "1 age"},
+			input: "2018-06-15T12:00:00Z\n",
+			want:  "2018\n",
+		},
+		{
+			name:  "without the year",
+			args:  []string{"-w", "80", "-now", "2020-06-15T12:00:00Z", "-age-year=false", "1 age"},
+			input: "2018-06-15T12:00:00Z\n",
+			want:  "24M\n",
+		},
+		{
+			name:  "invalid units",
+			args:  []string{"-w", "80", "-age-units", "s:x"},
+			input: "a\n",
+			want:  "---\nparsing -age-units: invalid limit for age unit s: x\n",
+		},
+	})
+}
+
+func TestTimeLayout(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "custom layout",
+			args:  []string{"-w", "80", "-now", "2020-06-15T12:00:00Z", "-time-layout", "02/01/2006 15h04", "1 age"},
+			input: "15/06/2020 09h00\n",
+			want:  "3h\n",
+		},
+		{
+			name:  "repeated",
+			args:  []string{"-w", "80", "-now", "2020-06-15T12:00:00Z", "-time-layout", "02/01/2006", "-time-layout", "2006.01.02", "1 age"},
+			input: "14/06/2020\n2020.06.13\n",
+			want:  "1d\n2d\n",
+		},
+		{
+			name:  "without a layout",
+			args:  []string{"-w", "80", "-now", "2020-06-15T12:00:00Z", "1 age"},
+			input: "15/06/2020 09h00\n",
+			want:  "15/06/2020 09h00\n---\nUnexpected date format: \"15/06/2020 09h00\"\n",
+		},
+	})
+}
+
+func TestPadRagged(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "short rows padded",
+			args:  []string{"-w", "80", "-p"},
+			input: "a\tb\tc\nd\ne\tf\n",
+			want:  "a  b  c\nd      \ne  f   \n",
+		},
+		{
+			name:  "later rows widen the table",
+			args:  []string{"-w", "80", "-p"},
+			input: "a\nb\tc\td\n",
+			want:  "a      \nb  c  d\n",
+		},
+		{
+			name:  "strict by default",
+			args:  []string{"-w", "80"},
+			input: "a\tb\tc\nd\n",
+			want:  "---\nNot all records have the same number of fields (try -p)\n",
+		},
+	})
+}
+
+func TestCSVInput(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "quoted fields",
+			args:  []string{"-w", "80", "-csv"},
+			input: "a,\"b,c\"\n\"say \"\"hi\"\"\",d\n",
+			want:  "a         b,c\nsay \"hi\"  d  \n",
+		},
+		{
+			name:  "multi-line field",
+			args:  []string{"-w", "80", "-csv", "-control", "escape"},
+			input: "a,\"b\nc\"\n",
+			want:  "a  b^Jc\n",
+		},
+		{
+			name:  "with -F",
+			args:  []string{"-w", "80", "-csv", "-F", ";"},
+			input: "a,b\n",
+			want:  "---\ncan't use both -csv and -F\n",
+		},
+	})
+}
+
+func TestCSVOutput(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "quoted fields",
+			args:  []string{"-w", "80", "-output", "csv"},
+			input: "a,b\tsay \"hi\"\nc\td\n",
+			want:  "\"a,b\",\"say \"\"hi\"\"\"\nc,d\n",
+		},
+		{
+			name:  "rendered values",
+			args:  []string{"-w", "80", "-output", "csv", "2 num"},
+			input: "a\t1234567\n",
+			want:  "a,\"1,234,567\"\n",
+		},
+		{
+			name:  "unknown format",
+			args:  []string{"-w", "80", "-output", "xml"},
+			input: "a\n",
+			want:  "---\nunknown -output format: xml\n",
+		},
+	})
+}
+
+func TestInputFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "colfmt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	one := filepath.Join(dir, "one")
+	if err := ioutil.WriteFile(one, []byte("a\t1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	two := filepath.Join(dir, "two")
+	if err := ioutil.WriteFile(two, []byte("bb\t22\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	checkRuns(t, []runTest{
+		{
+			name:  "files in order",
+			args:  []string{"-w", "80", "2 right", one, two},
+			input: "c\t3\n",
+			want:  "a    1\nbb  22\n",
+		},
+		{
+			name:  "stdin as -",
+			args:  []string{"-w", "80", "2 right", one, "-", two},
+			input: "c\t3\n",
+			want:  "a    1\nc    3\nbb  22\n",
+		},
+		{
+			name:  "missing file",
+			args:  []string{"-w", "80", "2 right", one, filepath.Join(dir, "missing")},
+			input: "",
+			want:  "---\nopening input: open " + filepath.Join(dir, "missing") + ": no such file or directory\n",
+		},
+	})
+}
+
+func TestHide(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "hidden column",
+			args:  []string{"-w", "80", "2 hide"},
+			input: "a\tbbbbbbbb\tc\n",
+			want:  "a  c\n",
+		},
+		{
+			name:  "not counted when fitting",
+			args:  []string{"-w", "10", "1 *; 2 hide; 3 *"},
+			input: "aaaa\tbbbbbbbbbbbb\tcccc\n",
+			want:  "aaaa  cccc\n",
+		},
+	})
+}
+
+func TestTruncateLeft(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "keeps the tail",
+			args:  []string{"-w", "80", "1 trunc-left 10c-10c; 2 1c"},
+			input: "src/server/handler.go\tx\n",
+			want:  "…andler.go  x\n",
+		},
+		{
+			name:  "multibyte runes",
+			args:  []string{"-w", "80", "1 trunc-left 4c-4c; 2 1c"},
+			input: "ñañañaña\tx\n",
+			want:  "…aña  x\n",
+		},
+		{
+			name:  "short cells",
+			args:  []string{"-w", "80", "1 trunc-left 10c-10c; 2 1c"},
+			input: "a.go\tx\n",
+			want:  "a.go        x\n",
+		},
+	})
+}
+
+func TestTruncateMiddle(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "keeps both ends",
+			args:  []string{"-w", "80", "1 trunc-mid 9c-9c; 2 1c"},
+			input: "abcdefghijklmnopqrstuvwxyz\tx\n",
+			want:  "abcd…wxyz  x\n",
+		},
+		{
+			name:  "even width",
+			args:  []string{"-w", "80", "1 trunc-mid 8c-8c; 2 1c"},
+			input: "abcdefghijklmnopqrstuvwxyz\tx\n",
+			want:  "abcd…xyz  x\n",
+		},
+		{
+			name:  "width 3",
+			args:  []string{"-w", "80", "1 trunc-mid 3c-3c; 2 1c"},
+			input: "abcdefghijklmnopqrstuvwxyz\tx\n",
+			want:  "a…z  x\n",
+		},
+		{
+			name:  "width 1",
+			args:  []string{"-w", "80", "1 trunc-mid 1c-1c; 2 1c"},
+			input: "abcdefghijklmnopqrstuvwxyz\tx\n",
+			want:  "a  x\n",
+		},
+	})
+}
+
+func TestColumnColor(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "after padding",
+			args:  []string{"-w", "80", "-color", "always", "1 fg:cyan; 2 fg:yellow"},
+			input: "a\tbb\nccc\td\n",
+			want:  "\x1b[36ma  \x1b[0m  \x1b[33mbb\x1b[0m\n\x1b[36mccc\x1b[0m  \x1b[33md \x1b[0m\n",
+		},
+		{
+			name:  "unknown color",
+			args:  []string{"-w", "80", "1 fg:mauve"},
+			input: "a\n",
+			want:  "---\nparsing column spec: unknown color: mauve\n",
+		},
+	})
+}
+
+func TestColorEnabled(t *testing.T) {
+	defer os.Unsetenv("NO_COLOR")
+	tests := []struct {
+		mode       string
+		isTerminal bool
+		noColor    bool
+		want       bool
+	}{
+		{"auto", true, false, true},
+		{"auto", false, false, false},
+		{"auto", true, true, false},
+		{"always", false, true, true},
+		{"never", true, false, false},
+	}
+	for _, test := range tests {
+		if test.noColor {
+			os.Setenv("NO_COLOR", "")
+		} else {
+			os.Unsetenv("NO_COLOR")
+		}
+		got, err := colorEnabled(test.mode, test.isTerminal)
+		if err != nil || got != test.want {
+			t.Errorf("%s, terminal %v, NO_COLOR %v: got %v, %v; want %v", test.mode, test.isTerminal, test.noColor, got, err, test.want)
+		}
+	}
+
+	if _, err := colorEnabled("sometimes", true); err == nil {
+		t.Errorf("unknown mode: got no error")
+	}
+}
+
+func TestZebra(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "every other row",
+			args:  []string{"-w", "80", "-color", "always", "-zebra"},
+			input: "a\t1\nb\t2\nc\t3\n",
+			want:  "a  1\n\x1b[2mb  2\x1b[0m\nc  3\n",
+		},
+		{
+			name:  "after the header",
+			args:  []string{"-w", "80", "-color", "always", "-zebra", "-H"},
+			input: "name\tn\na\t1\nb\t2\n",
+			want:  "name  n\na     1\n\x1b[2mb     2\x1b[0m\n",
+		},
+		{
+			name:  "without color",
+			args:  []string{"-w", "80", "-color", "never", "-zebra"},
+			input: "a\t1\nb\t2\n",
+			want:  "a  1\nb  2\n",
+		},
+	})
+}
+
+func TestFill(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "grows flexible columns",
+			args:  []string{"-w", "20", "-fill", "1 2c-*; 2 2c-*"},
+			input: "aaaa\tbb\n",
+			want:  "aaaa       bb       \n",
+		},
+		{
+			name:  "stops at WidthMax",
+			args:  []string{"-w", "20", "-fill", "1 2c-4c; 2 2c-*"},
+			input: "aa\tbb\n",
+			want:  "aa    bb            \n",
+		},
+		{
+			name:  "fixed columns stay",
+			args:  []string{"-w", "20", "-fill", "1 2c-2c; 2 2c-*"},
+			input: "aa\tbb\n",
+			want:  "aa  bb              \n",
+		},
+		{
+			name:  "off by default",
+			args:  []string{"-w", "20", "1 2c-*; 2 2c-*"},
+			input: "aa\tbb\n",
+			want:  "aa  bb\n",
+		},
+	})
+}
+
+func TestShrinkProportional(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "widest first by default",
+			args:  []string{"-w", "20", "1 2c-*; 2 2c-*"},
+			input: "aaaaaaaaaaaaaaaaaaaaa\tbbbbbbbbbbb\n",
+			want:  "aaaaaaaa…  bbbbbbbb…\n",
+		},
+		{
+			name:  "proportional",
+			args:  []string{"-w", "20", "-shrink", "proportional", "1 2c-*; 2 2c-*"},
+			input: "aaaaaaaaaaaaaaaaaaaaa\tbbbbbbbbbbb\n",
+			want:  "aaaaaaaaaa…  bbbbbb…\n",
+		},
+		{
+			name:  "above WidthMin",
+			args:  []string{"-w", "20", "-shrink", "proportional", "1 10c-*; 2 2c-*"},
+			input: "aaaaaaaaaaaaaaaaaaaaa\tbbbbbbbbbbb\n",
+			want:  "aaaaaaaaaaaa…  bbbb…\n",
+		},
+		{
+			name:  "unknown",
+			args:  []string{"-w", "20", "-shrink", "evenly"},
+			input: "a\n",
+			want:  "---\nunknown -shrink: evenly\n",
+		},
+	})
+}
+
+func TestPercentWidth(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "share of the terminal",
+			args:  []string{"-w", "40", "1 25%; 2 1c"},
+			input: "abc\tx\n",
+			want:  "abc         x\n",
+		},
+		{
+			name:  "truncated to the share",
+			args:  []string{"-w", "40", "1 25%; 2 1c"},
+			input: "abcdefghijklmnop\tx\n",
+			want:  "abcdefghi…  x\n",
+		},
+		{
+			name:  "follows -w",
+			args:  []string{"-w", "20", "1 25%; 2 1c"},
+			input: "abcdefghijklmnop\tx\n",
+			want:  "abcd…  x\n",
+		},
+		{
+			name:  "invalid",
+			args:  []string{"-w", "40", "1 x%"},
+			input: "a\n",
+			want:  "---\nparsing column spec: invalid width percentage: x%\n",
+		},
+	})
+}
+
+func TestColumnRange(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "every column in the range",
+			args:  []string{"-w", "80", "2-3 right 3c"},
+			input: "a\tb\tc\td\n",
+			want:  "a    b    c  d\n",
+		},
+		{
+			name:  "with a width range",
+			args:  []string{"-w", "80", "2-3 2c-2c"},
+			input: "a\tbbbb\tcccc\tdddd\n",
+			want:  "a  b…  c…  dddd\n",
+		},
+		{
+			name:  "backwards",
+			args:  []string{"-w", "80", "3-2 right"},
+			input: "a\n",
+			want:  "---\nparsing column spec: invalid column range: 3-2\n",
+		},
+		{
+			name:  "from zero",
+			args:  []string{"-w", "80", "0-2 right"},
+			input: "a\n",
+			want:  "---\nparsing column spec: invalid column range: 0-2\n",
+		},
+	})
+}
+
+func TestDefaultSpec(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "applies to unlisted columns",
+			args:  []string{"-w", "80", "default 4c-4c"},
+			input: "abcdefgh\tijklmnop\n",
+			want:  "abc…  ijk…\n",
+		},
+		{
+			name:  "explicit specs win",
+			args:  []string{"-w", "80", "default 4c-4c; 2 *"},
+			input: "abcdefgh\tijklmnop\n",
+			want:  "abc…  ijklmnop\n",
+		},
+	})
+}
+
+func TestNegativeColumn(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "last column",
+			args:  []string{"-w", "80", "--", "-1 right"},
+			input: "a\tb\nccc\tddd\n",
+			want:  "a      b\nccc  ddd\n",
+		},
+		{
+			name:  "second to last",
+			args:  []string{"-w", "80", "--", "-2 right"},
+			input: "a\tb\nccc\tddd\n",
+			want:  "  a  b  \nccc  ddd\n",
+		},
+		{
+			name:  "explicit column wins",
+			args:  []string{"-w", "80", "1 left; -2 right"},
+			input: "a\tb\nccc\tddd\n",
+			want:  "a    b  \nccc  ddd\n",
+		},
+		{
+			name:  "out of range",
+			args:  []string{"-w", "80", "--", "-3 right"},
+			input: "a\tb\n",
+			want:  "---\ncolumn -3 is out of range; records have 2 fields\n",
+		},
+	})
+}
+
+func TestEmptyCell(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "placeholder",
+			args:  []string{"-w", "80", "-empty", "-"},
+			input: "a\t\tc\n\tbb\t\n",
+			want:  "a  -   c\n-  bb  -\n",
+		},
+		{
+			name:  "whitespace only",
+			args:  []string{"-w", "80", "-empty", "-"},
+			input: "a\t  \n",
+			want:  "a  -\n",
+		},
+		{
+			name:  "affects widths",
+			args:  []string{"-w", "80", "-empty", "(none)"},
+			input: "a\t\tc\n",
+			want:  "a  (none)  c\n",
+		},
+		{
+			name:  "per column",
+			args:  []string{"-w", "80", "2 empty:?"},
+			input: "a\t\nb\tc\n",
+			want:  "a  ?\nb  c\n",
+		},
+		{
+			name:  "off by default",
+			args:  []string{"-w", "80"},
+			input: "a\t\tc\n",
+			want:  "a  c\n",
+		},
+	})
+}
+
+func TestControls(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "kept by default",
+			args:  []string{"-w", "80"},
+			input: "a\x07b\tc\n",
+			want:  "a\x07b  c\n",
+		},
+		{
+			name:  "escaped",
+			args:  []string{"-w", "80", "-control", "escape"},
+			input: "a\rb\tc\nd\x08\te\n",
+			want:  "a^Mb  c\nd^H   e\n",
+		},
+		{
+			name:  "stripped",
+			args:  []string{"-w", "80", "-control", "strip"},
+			input: "a\rb\tc\nd\x08\te\n",
+			want:  "ab  c\nd   e\n",
+		},
+		{
+			name:  "unicode untouched",
+			args:  []string{"-w", "80", "-control", "strip"},
+			input: "ñ✓\tc\n",
+			want:  "ñ✓  c\n",
+		},
+		{
+			name:  "unknown",
+			args:  []string{"-w", "80", "-control", "drop"},
+			input: "a\n",
+			want:  "---\nunknown -control: drop\n",
+		},
+	})
+}
+
+func TestSort(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "by text",
+			args:  []string{"-w", "80", "-sort", "2"},
+			input: "a\tpear\nb\tapple\nc\tfig\n",
+			want:  "b  apple\nc  fig  \na  pear \n",
+		},
+		{
+			name:  "header stays on top",
+			args:  []string{"-w", "80", "-H", "-sort", "2"},
+			input: "id\tfruit\na\tpear\nb\tapple\n",
+			want:  "id  fruit\nb   apple\na   pear \n",
+		},
+		{
+			name:  "reverse",
+			args:  []string{"-w", "80", "-sort", "2", "-reverse"},
+			input: "a\tpear\nb\tapple\nc\tfig\n",
+			want:  "a  pear \nc  fig  \nb  apple\n",
+		},
+		{
+			name:  "stable ties",
+			args:  []string{"-w", "80", "-sort", "2"},
+			input: "a\tx\nb\tw\nc\tx\nd\tw\n",
+			want:  "b  w\nd  w\na  x\nc  x\n",
+		},
+		{
+			name:  "strings put 10 before 2",
+			args:  []string{"-w", "80", "-sort", "1"},
+			input: "2\n10\n1\n",
+			want:  "1 \n10\n2 \n",
+		},
+	})
+}
+
+func TestSortNumeric(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "numbers",
+			args:  []string{"-w", "80", "-sort", "1", "-sort-numeric"},
+			input: "2\n10\n1\n",
+			want:  "1 \n2 \n10\n",
+		},
+		{
+			name:  "unparsable at the end",
+			args:  []string{"-w", "80", "-sort", "1", "-sort-numeric"},
+			input: "x\n2\n10\n",
+			want:  "2 \n10\nx \n",
+		},
+		{
+			name:  "reverse",
+			args:  []string{"-w", "80", "-sort", "1", "-sort-numeric", "-reverse"},
+			input: "2\n10\n1\n",
+			want:  "10\n2 \n1 \n",
+		},
+		{
+			name:  "unparsable at the end in reverse",
+			args:  []string{"-w", "80", "-sort", "1", "-sort-numeric", "-reverse"},
+			input: "x\n2\n10\n",
+			want:  "10\n2 \nx \n",
+		},
+		{
+			name:  "num column",
+			args:  []string{"-w", "80", "-sort", "1", "1 num"},
+			input: "2000\n10\n300\n",
+			want:  "   10\n  300\n2,000\n",
+		},
+		{
+			name:  "age column by timestamp",
+			args:  []string{"-w", "80", "-now", "2020-06-15T12:00:00Z", "-sort", "1", "1 age"},
+			input: "2020-06-15T11:00:00Z\n2020-06-14T12:00:00Z\n2020-06-15T11:59:00Z\n",
+			want:  " 1d\n60m\n60s\n",
+		},
+	})
+}
+
+func TestTotal(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "sums num columns",
+			args:  []string{"-w", "80", "-total", "2 num"},
+			input: "a\t1000\nb\t2500\n",
+			want:  "a      1,000\nb      2,500\ntotal  3,500\n",
+		},
+		{
+			name:  "aggregates",
+			args:  []string{"-w", "80", "-total", "2 total:avg; 3 total:max; 4 total:count"},
+			input: "a\t1\t5\tx\nb\t3\t9\ty\n",
+			want:  "a      1     5  x\nb      3     9  y\ntotal  2.00  9  2\n",
+		},
+		{
+			name:  "min",
+			args:  []string{"-w", "80", "2 total:min"},
+			input: "a\t4\nb\t3\n",
+			want:  "a      4\nb      3\ntotal  3\n",
+		},
+		{
+			name:  "unknown aggregate",
+			args:  []string{"-w", "80", "2 total:median"},
+			input: "a\t1\n",
+			want:  "---\nparsing column spec: unknown total: median\n",
+		},
+	})
+}
+
+func TestNumberRows(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "numbered",
+			args:  []string{"-w", "80", "-n"},
+			input: "a\nb\n",
+			want:  "1  a\n2  b\n",
+		},
+		{
+			name:  "right-aligned",
+			args:  []string{"-w", "80", "-n"},
+			input: "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\n",
+			want:  " 1  a\n 2  b\n 3  c\n 4  d\n 5  e\n 6  f\n 7  g\n 8  h\n 9  i\n10  j\n",
+		},
+		{
+			name:  "specs refer to input columns",
+			args:  []string{"-w", "80", "-n", "1 right"},
+			input: "a\tx\nbbb\ty\n",
+			want:  "1    a  x\n2  bbb  y\n",
+		},
+		{
+			name:  "after the header",
+			args:  []string{"-w", "80", "-n", "-H"},
+			input: "name\na\nb\n",
+			want:  "#  name\n1  a   \n2  b   \n",
+		},
+	})
+}
+
+func TestBool(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "truthy and falsey",
+			args:  []string{"-w", "80", "1 bool"},
+			input: "true\nFALSE\nyes\nNo\n1\n0\n",
+			want:  "✓\n✗\n✓\n✗\n✓\n✗\n",
+		},
+		{
+			name:  "custom glyphs",
+			args:  []string{"-w", "80", "-bool-glyphs", "Y,N", "1 bool"},
+			input: "true\nfalse\n",
+			want:  "Y\nN\n",
+		},
+		{
+			name:  "unknown value",
+			args:  []string{"-w", "80", "1 bool"},
+			input: "maybe\n",
+			want:  "maybe\n---\nUnexpected boolean format: \"maybe\"\n",
+		},
+		{
+			name:  "invalid glyphs",
+			args:  []string{"-w", "80", "-bool-glyphs", "Y", "1 bool"},
+			input: "true\n",
+			want:  "---\n-bool-glyphs needs two glyphs separated by a comma: \"Y\"\n",
+		},
+	})
+}
+
+func TestDecimalAlign(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "decimal points line up",
+			args:  []string{"-w", "80", "1 decimal"},
+			input: "3.5\n12.25\n100\n",
+			want:  "  3.5 \n 12.25\n100   \n",
+		},
+		{
+			name:  "with num",
+			args:  []string{"-w", "80", "1 num decimal"},
+			input: "1234.5\n7.125\n",
+			want:  "1,234.5  \n    7.125\n",
+		},
+		{
+			name:  "whole numbers",
+			args:  []string{"-w", "80", "1 decimal"},
+			input: "5\n100\n",
+			want:  "  5\n100\n",
+		},
+	})
+}
+
+func TestPercent(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "ratios",
+			args:  []string{"-w", "80", "1 percent"},
+			input: "0.8734\n0.05\n1\n",
+			want:  " 87.3%\n  5.0%\n100.0%\n",
+		},
+		{
+			name:  "precision",
+			args:  []string{"-w", "80", "1 percent decimals:2"},
+			input: "0.8734\n",
+			want:  "87.34%\n",
+		},
+		{
+			name:  "already out of 100",
+			args:  []string{"-w", "80", "1 percent:100"},
+			input: "87.34\n5\n",
+			want:  "87.3%\n 5.0%\n",
+		},
+		{
+			name:  "unparsable",
+			args:  []string{"-w", "80", "1 percent"},
+			input: "n/a\n",
+			want:  "n/a\n---\nUnexpected number format: \"n/a\"\n",
+		},
+	})
+}
+
+func TestFieldSeparator(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "several bytes",
+			args:  []string{"-w", "80", "-F", " | "},
+			input: "a | bb | c\ndd | e | f\n",
+			want:  "a   bb  c\ndd  e   f\n",
+		},
+		{
+			name:  "one byte",
+			args:  []string{"-w", "80", "-F", ","},
+			input: "a,b\n",
+			want:  "a  b\n",
+		},
+		{
+			name:  "empty",
+			args:  []string{"-w", "80", "-F", ""},
+			input: "a\n",
+			want:  "---\n-F can't be empty\n",
+		},
+	})
+}
+
+func TestSplitRegex(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "runs of whitespace",
+			args:  []string{"-w", "80", "-split-regex", " +"},
+			input: "  PID TTY   CMD\n 1234 pts/0 bash\n",
+			want:  "PID   TTY    CMD \n1234  pts/0  bash\n",
+		},
+		{
+			name:  "separators at the end",
+			args:  []string{"-w", "80", "-split-regex", ",+"},
+			input: "a,,b,\n",
+			want:  "a  b\n",
+		},
+		{
+			name:  "invalid",
+			args:  []string{"-w", "80", "-split-regex", "("},
+			input: "a\n",
+			want:  "---\nparsing -split-regex: error parsing regexp: missing closing ): `(`\n",
+		},
+	})
+}
+
+func TestPositions(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "fixed positions",
+			args:  []string{"-w", "80", "-positions", "0-4,4-8,8-"},
+			input: "abcdefghijkl\n1234567\n",
+			want:  "abcd  efgh  ijkl\n1234  567       \n",
+		},
+		{
+			name:  "short lines",
+			args:  []string{"-w", "80", "-positions", "0-2,2-4,4-"},
+			input: "ab\nabcdef\n",
+			want:  "ab        \nab  cd  ef\n",
+		},
+		{
+			name:  "runes",
+			args:  []string{"-w", "80", "-positions", "0-2,2-"},
+			input: "ñañ\n",
+			want:  "ña  ñ\n",
+		},
+		{
+			name:  "invalid",
+			args:  []string{"-w", "80", "-positions", "4-2"},
+			input: "a\n",
+			want:  "---\nparsing -positions: invalid position: 2\n",
+		},
+	})
+}
+
+func TestAutoSeparator(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "comma",
+			args:  []string{"-w", "80", "-auto"},
+			input: "a,b,c\nd,e,f\n",
+			want:  "a  b  c\nd  e  f\n",
+		},
+		{
+			name:  "pipe",
+			args:  []string{"-w", "80", "-auto"},
+			input: "a|b\nc|d\n",
+			want:  "a  b\nc  d\n",
+		},
+		{
+			name:  "tab over comma",
+			args:  []string{"-w", "80", "-auto"},
+			input: "a,1\tb\nc\td\n",
+			want:  "a,1  b\nc    d\n",
+		},
+		{
+			name:  "ambiguous falls back to tab",
+			args:  []string{"-w", "80", "-auto"},
+			input: "a,b|c\nd,e|f\n",
+			want:  "a,b|c\nd,e|f\n",
+		},
+	})
+}
+
+func TestVersion(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "short flag",
+			args:  []string{"-V"},
+			input: "",
+			want:  "colfmt " + Version + "\n",
+		},
+		{
+			name:  "before the spec and input",
+			args:  []string{"-version", "1 bogus"},
+			input: "a\tb\n",
+			want:  "colfmt " + Version + "\n",
+		},
+	})
+	if _, code := run([]string{"-V"}, ""); code != 0 {
+		t.Errorf("exit code: got %d, want 0", code)
+	}
+}
+
+func TestColumnTypeString(t *testing.T) {
+	tests := map[ColumnType]string{
+		TypeString:     "string",
+		TypeAge:        "age",
+		TypeEnum:       "enum",
+		TypeDuration:   "duration",
+		TypeOrdinal:    "ordinal",
+		TypeGroup:      "group",
+		TypeIP:         "ip",
+		TypeBar:        "bar",
+		TypeNumber:     "num",
+		TypeDate:       "date",
+		TypeBool:       "bool",
+		TypePercent:    "percent",
+		ColumnType(99): "ColumnType(99)",
+	}
+	for typ, want := range tests {
+		if got := typ.String(); got != want {
+			t.Errorf("%d: got %q, want %q", int(typ), got, want)
+		}
+	}
+}
+
+func TestTranspose(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "rows become columns",
+			args:  []string{"-w", "80", "-transpose"},
+			input: "a\tb\tc\n1\t2\t3\n",
+			want:  "a  1\nb  2\nc  3\n",
+		},
+		{
+			name:  "header becomes the first column",
+			args:  []string{"-w", "80", "-transpose", "-H"},
+			input: "name\tage\nbob\t42\nann\t7\n",
+			want:  "name  bob  ann\nage   42   7  \n",
+		},
+		{
+			name:  "ragged input is padded",
+			args:  []string{"-w", "80", "-transpose"},
+			input: "a\tb\tc\n1\n",
+			want:  "a  1\nb   \nc   \n",
+		},
+		{
+			name:  "specs refer to swapped columns",
+			args:  []string{"-w", "80", "-transpose", "2 right"},
+			input: "a\tb\n100\t2\n",
+			want:  "a  100\nb    2\n",
+		},
+	})
+}
+
+func TestRepeatHeader(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "every N records",
+			args:  []string{"-w", "80", "-H", "-repeat-header", "2"},
+			input: "name\tn\na\t1\nb\t2\nc\t3\n",
+			want:  "name  n\na     1\nb     2\nname  n\nc     3\n",
+		},
+		{
+			name:  "with row numbers",
+			args:  []string{"-w", "80", "-H", "-n", "-repeat-header", "2"},
+			input: "name\na\nb\nc\n",
+			want:  "#  name\n1  a   \n2  b   \n#  name\n3  c   \n",
+		},
+		{
+			name:  "zebra skips repeated headers",
+			args:  []string{"-w", "80", "-H", "-color", "always", "-zebra", "-repeat-header", "1"},
+			input: "name\na\nb\n",
+			want:  "name\na   \nname\n\x1b[2mb   \x1b[0m\n",
+		},
+		{
+			name:  "needs -H",
+			args:  []string{"-w", "80", "-repeat-header", "2"},
+			input: "a\n",
+			want:  "---\n-repeat-header needs -H\n",
+		},
+	})
+}
+
+func TestFillChar(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "dot leaders",
+			args:  []string{"-w", "80", "-fill-char", "."},
+			input: "Intro\t1\nChapter one\t5\n",
+			want:  "Intro......  1\nChapter one  5\n",
+		},
+		{
+			name:  "right-aligned",
+			args:  []string{"-w", "80", "-fill-char", ".", "2 right"},
+			input: "a\t1\nb\t100\n",
+			want:  "a  ..1\nb  100\n",
+		},
+		{
+			name:  "per column",
+			args:  []string{"-w", "80", "1 fill:-"},
+			input: "a\t1\nbbb\t2\n",
+			want:  "a--  1\nbbb  2\n",
+		},
+		{
+			name:  "too wide",
+			args:  []string{"-w", "80", "-fill-char", "ab"},
+			input: "a\n",
+			want:  "---\n-fill-char must be a single character, one column wide: \"ab\"\n",
+		},
+	})
+}
+
+func TestCaseTransform(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "upper",
+			args:  []string{"-w", "80", "1 upper"},
+			input: "ok\nfailed\n",
+			want:  "OK    \nFAILED\n",
+		},
+		{
+			name:  "lower",
+			args:  []string{"-w", "80", "1 lower"},
+			input: "OK\nÉTÉ\n",
+			want:  "ok \nété\n",
+		},
+		{
+			name:  "title",
+			args:  []string{"-w", "80", "1 title"},
+			input: "hello world\nñandú grande\n",
+			want:  "Hello World \nÑandú Grande\n",
+		},
+		{
+			name:  "then truncated",
+			args:  []string{"-w", "80", "1 upper 4c-4c right; 2 1c"},
+			input: "abcdef\tx\nab\ty\n",
+			want:  "…DEF  x\n  AB  y\n",
+		},
+	})
+}
+
+func TestPath(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "elides whole directories",
+			args:  []string{"-w", "80", "1 path 16c-16c; 2 1c"},
+			input: "/usr/local/share/bin/foo\tx\n",
+			want:  "/usr/…/bin/foo    x\n",
+		},
+		{
+			name:  "fits",
+			args:  []string{"-w", "80", "1 path 16c-16c; 2 1c"},
+			input: "/usr/bin/foo\tx\n",
+			want:  "/usr/bin/foo      x\n",
+		},
+		{
+			name:  "relative path",
+			args:  []string{"-w", "80", "1 path 13c-13c; 2 1c"},
+			input: "src/a/b/c/main.go\tx\n",
+			want:  "src/…/main.go  x\n",
+		},
+		{
+			name:  "too narrow for the ends",
+			args:  []string{"-w", "80", "1 path 12c-12c; 2 1c"},
+			input: "src/a/b/c/main.go\tx\n",
+			want:  "src/a/b/c/m…  x\n",
+		},
+		{
+			name:  "not a path",
+			args:  []string{"-w", "80", "1 path 6c-6c; 2 1c"},
+			input: "abcdefghij\tx\n",
+			want:  "abcde…  x\n",
+		},
+	})
+}
+
+func TestSpecComments(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "to the end of the line",
+			args:  []string{"-w", "80", "1 right 4c; # the id\n2 3c # the name"},
+			input: "a\tb\n",
+			want:  "   a  b  \n",
+		},
+		{
+			name:  "# inside a word",
+			args:  []string{"-w", "80", "1 empty:#"},
+			input: "\tb\n",
+			want:  "#  b\n",
+		},
+		{
+			name:  "comment only",
+			args:  []string{"-w", "80", "# nothing"},
+			input: "a\tb\n",
+			want:  "a  b\n",
+		},
+	})
+}
+
+func TestNamedColumns(t *testing.T) {
+	checkRuns(t, []runTest{
+		{
+			name:  "bound to header names",
+			args:  []string{"-w", "80", "-H", "name:n right; name:who 5c"},
+			input: "who\tn\nbob\t7\nann\t12\n",
+			want:  "who     n\nbob     7\nann    12\n",
+		},
+		{
+			name:  "unknown name",
+			args:  []string{"-w", "80", "-H", "name:size right"},
+			input: "who\tn\nbob\t7\n",
+			want:  "---\nno column is named \"size\"\n",
+		},
+		{
+			name:  "needs -H",
+			args:  []string{"-w", "80", "name:n right"},
+			input: "who\tn\n",
+			want:  "---\ncolumns chosen by name need -H, without -transpose\n",
+		},
+	})
+}
@@ -0,0 +1,230 @@
+package colfmt
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/width"
+)
+
+// returns the number of terminal columns needed to display s
+func (e *env) displayWidth(s string) int {
+	width := 0
+	for i := 0; i < len(s); {
+		if c := s[i]; c < utf8.RuneSelf && c != '\x1b' { // common case
+			width++
+			i++
+			continue
+		}
+		if n := e.escapeLength(s[i:]); n > 0 {
+			i += n
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		width += runeWidth(r)
+		i += size
+	}
+	return width
+}
+
+// returns the length of the ANSI escape sequence, like ESC [ 1 ; 31 m,
+// which starts s.  returns 0 if s doesn't start with one or escape
+// sequences aren't being recognized (see ansiAware)
+func (e *env) escapeLength(s string) int {
+	if !e.ansiAware || !strings.HasPrefix(s, "\x1b[") {
+		return 0
+	}
+	for i := 2; i < len(s); i++ {
+		if s[i] >= 0x40 && s[i] <= 0x7e { // final byte
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// returns the number of terminal columns needed to display r.  East
+// Asian wide and fullwidth characters take two columns.  combining
+// marks take none, since they share a column with the preceding rune.
+func runeWidth(r rune) int {
+	if r < utf8.RuneSelf {
+		return 1
+	}
+	if unicode.In(r, unicode.Mn, unicode.Me) {
+		return 0
+	}
+	switch width.LookupRune(r).Kind() {
+	case width.EastAsianWide, width.EastAsianFullwidth:
+		return 2
+	}
+	return 1
+}
+
+// returns the longest prefix of s which fits within width columns.
+// never splits a rune or escape sequence.  if the prefix contains
+// escape sequences, it ends by resetting their attributes.
+func (e *env) head(s string, width int) string {
+	i := e.cut(s, width)
+	if i < len(s) && e.ansiAware && strings.Contains(s[0:i], "\x1b[") {
+		return s[0:i] + sgrReset
+	}
+	return s[0:i]
+}
+
+// returns the length in bytes of the longest prefix of s which fits
+// within width columns.  never splits a rune or escape sequence
+func (e *env) cut(s string, width int) int {
+	for i := 0; i < len(s); {
+		if n := e.escapeLength(s[i:]); n > 0 {
+			i += n
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		width -= runeWidth(r)
+		if width < 0 {
+			return i
+		}
+		i += size
+	}
+	return len(s)
+}
+
+// returns the SGR escape sequences in effect after s, given those in
+// effect before it.  a reset clears them
+func (e *env) sgrState(before, s string) string {
+	state := before
+	for i := 0; i < len(s); i++ {
+		n := e.escapeLength(s[i:])
+		if n == 0 {
+			continue
+		}
+		switch seq := s[i : i+n]; {
+		case seq == sgrReset || seq == "\x1b[m":
+			state = ""
+		case strings.HasSuffix(seq, "m"):
+			state += seq
+		}
+		i += n - 1
+	}
+	return state
+}
+
+// returns the longest suffix of s which fits within width columns.
+// never splits a rune or escape sequence.  escape sequences from the
+// part which was cut are kept, so the suffix has the same attributes.
+func (e *env) tail(s string, width int) string {
+	remaining := e.displayWidth(s)
+	var escapes strings.Builder
+	for i := 0; i < len(s); {
+		if remaining <= width {
+			return escapes.String() + s[i:]
+		}
+		if n := e.escapeLength(s[i:]); n > 0 {
+			escapes.WriteString(s[i : i+n])
+			i += n
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		remaining -= runeWidth(r)
+		i += size
+	}
+	return escapes.String()
+}
+
+// pads s with fill to fill width columns, placing it according to
+// align.  fill should be one column wide (see isFillChar).  when
+// centered padding can't be split evenly, the extra space goes on the
+// right
+func (e *env) pad(s string, width int, align Alignment, fill string) string {
+	padding := width - e.displayWidth(s)
+	if padding <= 0 {
+		return s
+	}
+
+	switch align {
+	case AlignRight:
+		return strings.Repeat(fill, padding) + s
+	case AlignCenter:
+		left := padding / 2
+		return strings.Repeat(fill, left) + s + strings.Repeat(fill, padding-left)
+	default:
+		return s + strings.Repeat(fill, padding)
+	}
+}
+
+// like pad, but leaves out the padding which would follow s.  an empty
+// s stays empty, since nothing follows its padding
+func (e *env) padLeading(s string, width int, align Alignment, fill string) string {
+	padding := width - e.displayWidth(s)
+	if padding <= 0 || s == "" {
+		return s
+	}
+
+	switch align {
+	case AlignRight:
+		return strings.Repeat(fill, padding) + s
+	case AlignCenter:
+		return strings.Repeat(fill, padding/2) + s
+	default:
+		return s
+	}
+}
+
+// reports whether s is a single character, one column wide, which can
+// pad cells
+func isFillChar(s string) bool {
+	r, size := utf8.DecodeRuneInString(s)
+	return size > 0 && size == len(s) && runeWidth(r) == 1
+}
+
+// breaks s into lines which each fit within width columns.  lines
+// break between words when possible.  words too wide for a line of
+// their own are split, without splitting a rune or escape sequence.
+// each line ends with a reset if it's colored, and the next line
+// starts with the colors which were in effect.
+func (e *env) wrap(s string, width int) []string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(s) {
+		for e.displayWidth(word) > width {
+			if line != "" {
+				lines = append(lines, line)
+				line = ""
+			}
+			i := e.cut(word, width)
+			if i == 0 {
+				// width is too narrow for even one rune
+				_, i = utf8.DecodeRuneInString(word)
+			}
+			lines = append(lines, word[0:i])
+			word = word[i:]
+		}
+		switch {
+		case word == "":
+		case line == "":
+			line = word
+		case e.displayWidth(line)+1+e.displayWidth(word) <= width:
+			line += " " + word
+		default:
+			lines = append(lines, line)
+			line = word
+		}
+	}
+	if line != "" || len(lines) == 0 {
+		lines = append(lines, line)
+	}
+
+	// carry colors from one line to the next
+	if e.ansiAware {
+		active := ""
+		for i, line := range lines {
+			before := active
+			active = e.sgrState(before, line)
+			lines[i] = before + line
+			if active != "" {
+				lines[i] += sgrReset
+			}
+		}
+	}
+	return lines
+}
@@ -0,0 +1,65 @@
+package colfmt
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWrap(t *testing.T) {
+	tests := []struct {
+		s     string
+		width int
+		ansi  bool
+		want  []string
+	}{
+		{"the quick brown fox", 9, false, []string{"the quick", "brown fox"}},
+		{"abcdefghij", 4, false, []string{"abcd", "efgh", "ij"}},
+		{"", 4, false, []string{""}},
+		{"日本語", 1, false, []string{"日", "本", "語"}},
+		{
+			"\x1b[31mabcdef", 5, true,
+			[]string{"\x1b[31mabcde\x1b[0m", "\x1b[31mf\x1b[0m"},
+		},
+		{
+			"\x1b[31mabcdefghijklmnop\x1b[0m", 5, true,
+			[]string{
+				"\x1b[31mabcde\x1b[0m",
+				"\x1b[31mfghij\x1b[0m",
+				"\x1b[31mklmno\x1b[0m",
+				"\x1b[31mp\x1b[0m",
+			},
+		},
+		{
+			"\x1b[1mab\x1b[0m cd", 2, true,
+			[]string{"\x1b[1mab\x1b[0m", "cd"},
+		},
+	}
+	for _, test := range tests {
+		e := &env{ansiAware: test.ansi}
+		got := e.wrap(test.s, test.width)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("wrap(%q, %d) = %q, want %q", test.s, test.width, got, test.want)
+		}
+	}
+}
+
+func TestHead(t *testing.T) {
+	tests := []struct {
+		s     string
+		width int
+		ansi  bool
+		want  string
+	}{
+		{"abcdef", 3, false, "abc"},
+		{"abc", 5, false, "abc"},
+		{"日本語", 3, false, "日"},
+		{"\x1b[31mabcdef", 3, true, "\x1b[31mabc\x1b[0m"},
+		{"\x1b[31mabc", 3, true, "\x1b[31mabc"},
+	}
+	for _, test := range tests {
+		e := &env{ansiAware: test.ansi}
+		if got := e.head(test.s, test.width); got != test.want {
+			t.Errorf("head(%q, %d) = %q, want %q", test.s, test.width, got, test.want)
+		}
+	}
+}